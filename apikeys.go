@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhiillos/gator/internal/database"
+)
+
+// Prefix of every API key, so leaked keys are easy to recognize
+const apiKeyPrefix = "gator_"
+
+// Number of characters of a key shown by apikey list to tell keys apart
+const apiKeyShownLength = len(apiKeyPrefix) + 8
+
+// Returns a new random API key
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// Returns the hash of an API key stored in the database. Keys are random
+// enough that an unsalted hash cannot be reversed.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the Fever API key of a user signing in with the API key as the
+// password. Fever clients send the MD5 hash of "username:password".
+func feverAPIKey(username, key string) string {
+	sum := md5.Sum([]byte(username + ":" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Creates, lists or revokes the API keys of the current user
+func handlerAPIKey(s *state, cmd command) error {
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		return fmt.Errorf("User %q not found", s.cfg.CurrentUsername)
+	}
+	switch cmd.args[0] {
+	case "create":
+		name := strings.Join(cmd.args[1:], " ")
+		key, err := generateAPIKey()
+		if err != nil {
+			return fmt.Errorf("Error generating API key: %w", err)
+		}
+		apiKey, err := s.db.CreateAPIKey(context.Background(), database.CreateAPIKeyParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UserID:    user.ID,
+			Name:      name,
+			KeyHash:   hashAPIKey(key),
+			Prefix:    key[:apiKeyShownLength],
+			FeverKeyHash: sql.NullString{
+				String: hashAPIKey(feverAPIKey(user.Name, key)),
+				Valid:  true,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("Error creating API key: %w", err)
+		}
+		fmt.Printf("Created API key %s for user %q:\n\n  %s\n\n", apiKey.ID, user.Name, key)
+		fmt.Println("Store it now, it cannot be shown again.")
+		fmt.Printf("Fever clients sign in with the user name %q and this key as the password.\n", user.Name)
+	case "list":
+		if len(cmd.args) > 1 {
+			return errors.New("Usage: gator apikey list")
+		}
+		keys, err := s.db.GetAPIKeysForUser(context.Background(), user.ID)
+		if err != nil {
+			return fmt.Errorf("Error getting API keys: %w", err)
+		}
+		return render(cmd, apiKeyOutputs(keys), func() {
+			if len(keys) == 0 {
+				fmt.Printf("User %q has no API keys\n", user.Name)
+				return
+			}
+			for _, key := range keys {
+				status := "never used"
+				if key.LastUsedAt.Valid {
+					status = "last used " + key.LastUsedAt.Time.Format("2006-01-02 15:04:05")
+				}
+				if key.RevokedAt.Valid {
+					status = "revoked " + key.RevokedAt.Time.Format("2006-01-02 15:04:05")
+				}
+				if !key.RevokedAt.Valid && !key.FeverKeyHash.Valid {
+					status += ", no Fever support"
+				}
+				fmt.Printf("%s  %s...  %-20s %s\n", key.ID, key.Prefix, key.Name, status)
+			}
+		})
+	case "revoke":
+		if len(cmd.args) != 2 {
+			return errors.New("Usage: gator apikey revoke <id>")
+		}
+		id, err := uuid.Parse(cmd.args[1])
+		if err != nil {
+			return fmt.Errorf("%q is not a valid API key ID", cmd.args[1])
+		}
+		count, err := s.db.RevokeAPIKey(context.Background(), database.RevokeAPIKeyParams{ID: id, UserID: user.ID})
+		if err != nil {
+			return fmt.Errorf("Error revoking API key: %w", err)
+		}
+		if count == 0 {
+			return fmt.Errorf("User %q has no active API key %s", user.Name, id)
+		}
+		fmt.Printf("Revoked API key %s\n", id)
+	default:
+		return fmt.Errorf("Unknown apikey action %q, use create, list or revoke", cmd.args[0])
+	}
+	return nil
+}
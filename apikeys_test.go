@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhiillos/gator/internal/database"
+)
+
+var apiKeyPattern = regexp.MustCompile(`gator_[0-9a-f]{64}`)
+
+// Creates an API key for the current user and returns it
+func createAPIKey(t *testing.T, s *state, name string) string {
+	t.Helper()
+	out := mustRun(t, s, "apikey", "create", name)
+	key := apiKeyPattern.FindString(out)
+	if key == "" {
+		t.Fatalf("apikey create printed no key:\n%s", out)
+	}
+	return key
+}
+
+func listAPIKeys(t *testing.T, s *state) []apiKeyOutput {
+	t.Helper()
+	var keys []apiKeyOutput
+	out := mustRun(t, s, "--output", "json", "apikey", "list")
+	if err := json.Unmarshal([]byte(out), &keys); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+	return keys
+}
+
+func TestAPIKeyCreate(t *testing.T) {
+	s := newTestState(t)
+	mustRun(t, s, "register", "alice")
+
+	out := mustRun(t, s, "apikey", "create", "my", "phone")
+	assertContains(t, out, `for user "alice"`, "Store it now", `Fever clients sign in with the user name "alice"`)
+	key := apiKeyPattern.FindString(out)
+	if key == "" {
+		t.Fatalf("apikey create printed no key:\n%s", out)
+	}
+
+	user, err := s.db.GetUserByAPIKey(context.Background(), hashAPIKey(key))
+	if err != nil || user.Name != "alice" {
+		t.Errorf("Key does not authenticate alice: %v", err)
+	}
+	user, err = s.db.GetUserByFeverKey(context.Background(), hashAPIKey(feverAPIKey("alice", key)))
+	if err != nil || user.Name != "alice" {
+		t.Errorf("Key does not authenticate alice with Fever: %v", err)
+	}
+	if createAPIKey(t, s, "") == key {
+		t.Error("Two keys are the same")
+	}
+}
+
+func TestAPIKeyListAndRevoke(t *testing.T) {
+	s := newTestState(t)
+	mustRun(t, s, "register", "alice")
+	assertContains(t, mustRun(t, s, "apikey", "list"), `User "alice" has no API keys`)
+
+	phone := createAPIKey(t, s, "phone")
+	createAPIKey(t, s, "laptop")
+	out := mustRun(t, s, "apikey", "list")
+	assertContains(t, out, phone[:apiKeyShownLength]+"...", "phone", "laptop", "never used")
+	if strings.Contains(out, phone[apiKeyShownLength:]) {
+		t.Errorf("apikey list shows the whole key:\n%s", out)
+	}
+	if strings.Contains(out, "no Fever support") {
+		t.Errorf("New keys are listed without Fever support:\n%s", out)
+	}
+
+	keys := listAPIKeys(t, s)
+	if len(keys) != 2 {
+		t.Fatalf("Got %d keys, want 2", len(keys))
+	}
+	var phoneKey apiKeyOutput
+	for _, key := range keys {
+		if key.Name == "phone" {
+			phoneKey = key
+		}
+		if !key.Fever || key.RevokedAt != nil || key.LastUsedAt != nil {
+			t.Errorf("Unexpected new key %+v", key)
+		}
+	}
+
+	// Other users can neither see nor revoke the key
+	mustRun(t, s, "register", "bob")
+	if keys := listAPIKeys(t, s); len(keys) != 0 {
+		t.Errorf("bob sees alice's keys: %+v", keys)
+	}
+	if _, err := runCommand(t, s, "apikey", "revoke", phoneKey.ID.String()); err == nil {
+		t.Error("bob revoked alice's key")
+	}
+
+	mustRun(t, s, "login", "alice")
+	out = mustRun(t, s, "apikey", "revoke", phoneKey.ID.String())
+	assertContains(t, out, "Revoked API key "+phoneKey.ID.String())
+	assertContains(t, mustRun(t, s, "apikey", "list"), "revoked ")
+	if _, err := s.db.GetUserByAPIKey(context.Background(), hashAPIKey(phone)); err == nil {
+		t.Error("Revoked key still authenticates")
+	}
+	if _, err := s.db.GetUserByFeverKey(context.Background(), hashAPIKey(feverAPIKey("alice", phone))); err == nil {
+		t.Error("Revoked key still authenticates with Fever")
+	}
+	if _, err := runCommand(t, s, "apikey", "revoke", phoneKey.ID.String()); err == nil {
+		t.Error("Revoking a key twice succeeded")
+	}
+
+	for _, args := range [][]string{
+		{"apikey", "list", "extra"},
+		{"apikey", "revoke"},
+		{"apikey", "revoke", "not-an-id"},
+		{"apikey", "rotate"},
+		{"apikey"},
+	} {
+		if _, err := runCommand(t, s, args...); err == nil {
+			t.Errorf("gator %s succeeded", strings.Join(args, " "))
+		}
+	}
+
+	// Keys created before Fever support have no Fever hash
+	user, _ := s.db.GetUser(context.Background(), "alice")
+	_, err := s.db.CreateAPIKey(context.Background(), database.CreateAPIKeyParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UserID:    user.ID,
+		Name:      "old",
+		KeyHash:   hashAPIKey("gator_old"),
+		Prefix:    "gator_old",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, mustRun(t, s, "apikey", "list"), "old                  never used, no Fever support")
+	for _, key := range listAPIKeys(t, s) {
+		if key.Fever != (key.Name != "old") {
+			t.Errorf("Key %s has fever %v", key.Name, key.Fever)
+		}
+	}
+}
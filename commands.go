@@ -0,0 +1,474 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Stores command names, their positional arguments and parsed flags
+type command struct {
+	name  string
+	args  []string
+	flags *flag.FlagSet
+}
+
+// Describes a command for running it and for generating its help
+type commandInfo struct {
+	name string
+	// Synopsis of the positional arguments, e.g. "<name> <URL>"
+	args        string
+	description string
+	minArgs     int
+	// Maximum number of positional arguments, or -1 for no limit
+	maxArgs int
+	// Defines the flags of the command, if it has any
+	flags func(fs *flag.FlagSet)
+	// Whether the command runs without checking that the database schema is
+	// up to date
+	skipSchemaCheck bool
+	// Whether flags end at the first positional argument, so that later
+	// arguments may start with "-"
+	flagsBeforeArgs bool
+	handler         func(*state, command) error
+}
+
+// Stores all available commands
+type commands struct {
+	commands map[string]commandInfo
+	// Command names in registration order, for listing them in help
+	names []string
+}
+
+// Returned by handlers for invalid arguments. run adds the usage of the
+// command to the message.
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+// Returns the value of a string flag of the command
+func (cmd command) stringFlag(name string) string {
+	return cmd.flags.Lookup(name).Value.String()
+}
+
+// Returns the value of a boolean flag of the command
+func (cmd command) boolFlag(name string) bool {
+	return cmd.flags.Lookup(name).Value.(flag.Getter).Get().(bool)
+}
+
+// Returns the value of an integer flag of the command
+func (cmd command) intFlag(name string) int {
+	return cmd.flags.Lookup(name).Value.(flag.Getter).Get().(int)
+}
+
+// Returns the usage line of a command
+func (info commandInfo) usage() string {
+	usage := "gator " + info.name
+	if info.args != "" {
+		usage += " " + info.args
+	}
+	if info.flags != nil {
+		usage += " [flags]"
+	}
+	return usage
+}
+
+// Defines the flags accepted by every command
+func globalFlags(fs *flag.FlagSet) {
+	fs.String("output", "text", "print listings in this `format`: text, json, csv or tsv")
+}
+
+// Splits the command line into the command name and its arguments. Global
+// flags given before the command name are passed on to the command.
+func splitCommandLine(args []string) (string, []string, error) {
+	fs := flag.NewFlagSet("gator", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	globalFlags(fs)
+	err := fs.Parse(args)
+	if err != nil {
+		return "", nil, err
+	}
+	if fs.NArg() == 0 {
+		return "", nil, errors.New("No command provided")
+	}
+	cmdArgs := []string{}
+	fs.Visit(func(f *flag.Flag) {
+		cmdArgs = append(cmdArgs, "-"+f.Name+"="+f.Value.String())
+	})
+	return fs.Arg(0), append(cmdArgs, fs.Args()[1:]...), nil
+}
+
+// Returns a flag set with the global flags and the flags of a command defined
+func (info commandInfo) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(info.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	globalFlags(fs)
+	if info.flags != nil {
+		info.flags(fs)
+	}
+	return fs
+}
+
+// Parses flags that may be mixed with positional arguments, returning the
+// positional arguments
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		err := fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// This function parses the arguments of a command and calls its handler
+func (c *commands) run(s *state, cmd command) error {
+	info, ok := c.commands[cmd.name]
+	if !ok {
+		return c.unknownCommandError(cmd.name)
+	}
+	fs := info.flagSet()
+	var args []string
+	var err error
+	if info.flagsBeforeArgs {
+		err = fs.Parse(cmd.args)
+		args = fs.Args()
+	} else {
+		args, err = parseFlags(fs, cmd.args)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		printCommandHelp(os.Stdout, info)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s\nUsage: %s", err, info.usage())
+	}
+	if len(args) < info.minArgs || (info.maxArgs >= 0 && len(args) > info.maxArgs) {
+		return fmt.Errorf("Wrong number of arguments for %s\nUsage: %s", info.name, info.usage())
+	}
+	if !containsString(outputFormats, fs.Lookup("output").Value.String()) {
+		return fmt.Errorf("Unknown output format %q, use one of %s", fs.Lookup("output").Value.String(), strings.Join(outputFormats, ", "))
+	}
+	if !info.skipSchemaCheck {
+		err = s.checkSchema()
+		if err != nil {
+			return err
+		}
+	}
+	cmd.args = args
+	cmd.flags = fs
+	err = info.handler(s, cmd)
+	var usageErr usageError
+	if errors.As(err, &usageErr) {
+		return fmt.Errorf("%s\nUsage: %s", err, info.usage())
+	}
+	return err
+}
+
+// This function registers a new command
+func (c *commands) register(info commandInfo) {
+	c.commands[info.name] = info
+	c.names = append(c.names, info.name)
+}
+
+// Returns an error for an unknown command, suggesting similarly named ones
+func (c *commands) unknownCommandError(name string) error {
+	suggestions := []string{}
+	for _, known := range c.names {
+		if levenshtein(name, known) <= 2 || (len(name) > 1 && strings.HasPrefix(known, name)) {
+			suggestions = append(suggestions, known)
+		}
+	}
+	msg := fmt.Sprintf("Command %q does not exist.", name)
+	if len(suggestions) > 0 {
+		sort.Strings(suggestions)
+		msg += fmt.Sprintf(" Did you mean %s?", strings.Join(suggestions, " or "))
+	}
+	return errors.New(msg + "\nRun \"gator help\" for a list of commands.")
+}
+
+// Returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// Prints the list of all commands
+func (c *commands) printHelp(w io.Writer) {
+	fmt.Fprint(w, "Usage:\n  gator <command> [arguments]\n\nCommands:\n")
+	for _, name := range c.names {
+		info := c.commands[name]
+		synopsis := strings.TrimPrefix(info.usage(), "gator ")
+		fmt.Fprintf(w, "  %-34s %s\n", synopsis, info.description)
+	}
+	fmt.Fprint(w, "\nGlobal flags:\n")
+	printFlags(w, globalFlags)
+	fmt.Fprint(w, "\nRun \"gator help <command>\" or \"gator <command> --help\" for details on a command.\n")
+}
+
+// Prints the defaults of the flags defined by the given function
+func printFlags(w io.Writer, define func(fs *flag.FlagSet)) {
+	fs := flag.NewFlagSet("", flag.ContinueOnError)
+	fs.SetOutput(w)
+	define(fs)
+	fs.PrintDefaults()
+}
+
+// Prints the usage, description and flags of a command
+func printCommandHelp(w io.Writer, info commandInfo) {
+	fmt.Fprintf(w, "Usage: %s\n\n%s\n", info.usage(), info.description)
+	if info.flags != nil {
+		fmt.Fprint(w, "\nFlags:\n")
+		printFlags(w, info.flags)
+	}
+	fmt.Fprint(w, "\nGlobal flags:\n")
+	printFlags(w, globalFlags)
+}
+
+// Prints help for all commands, or for the command given as an argument
+func (c *commands) handlerHelp(s *state, cmd command) error {
+	if len(cmd.args) == 0 {
+		c.printHelp(os.Stdout)
+		return nil
+	}
+	info, ok := c.commands[cmd.args[0]]
+	if !ok {
+		return c.unknownCommandError(cmd.args[0])
+	}
+	printCommandHelp(os.Stdout, info)
+	return nil
+}
+
+// Returns the registry of all gator commands
+func newCommands() *commands {
+	cmds := &commands{
+		commands: make(map[string]commandInfo),
+	}
+	cmds.register(commandInfo{
+		name:        "register",
+		args:        "<username>",
+		description: "Registers the specified username to the database",
+		minArgs:     1,
+		maxArgs:     1,
+		handler:     handlerRegister,
+	})
+	cmds.register(commandInfo{
+		name:        "login",
+		args:        "<username>",
+		description: "Logs the specified user in",
+		minArgs:     1,
+		maxArgs:     1,
+		handler:     handlerLogin,
+	})
+	cmds.register(commandInfo{
+		name:        "reset",
+		description: "Removes all the users from the database",
+		handler:     handlerReset,
+	})
+	cmds.register(commandInfo{
+		name:        "users",
+		description: "Prints all the users in the database",
+		handler:     handlerUsers,
+	})
+	cmds.register(commandInfo{
+		name:        "addfeed",
+		args:        "<name> <URL>",
+		description: "Adds an RSS, Atom or JSON feed, or the feed advertised by a web page, and follows it. The URL must be reachable",
+		minArgs:     2,
+		maxArgs:     2,
+		handler:     handlerAddfeed,
+	})
+	cmds.register(commandInfo{
+		name:        "feeds",
+		description: "Prints all feeds in the database along with their fetch health",
+		handler:     handlerFeeds,
+	})
+	cmds.register(commandInfo{
+		name:        "enablefeed",
+		args:        "<URL>",
+		description: "Re-enables a feed that was disabled after repeated fetch failures",
+		minArgs:     1,
+		maxArgs:     1,
+		handler:     handlerEnableFeed,
+	})
+	cmds.register(commandInfo{
+		name:        "follow",
+		args:        "<URL>",
+		description: "Follows a feed",
+		minArgs:     1,
+		maxArgs:     1,
+		handler:     handlerFollow,
+	})
+	cmds.register(commandInfo{
+		name:        "unfollow",
+		args:        "<URL>",
+		description: "Unfollows a feed",
+		minArgs:     1,
+		maxArgs:     1,
+		handler:     handlerUnfollow,
+	})
+	cmds.register(commandInfo{
+		name:        "following",
+		description: "Lists the feeds you are following",
+		handler:     handlerFollowing,
+	})
+	cmds.register(commandInfo{
+		name:        "agg",
+		args:        "<duration> [concurrency]",
+		description: "Collects feeds at the given interval, fetching up to concurrency feeds in parallel (defaults to 1)",
+		minArgs:     1,
+		maxArgs:     2,
+		flags: func(fs *flag.FlagSet) {
+			fs.Bool("allow-private-feeds", false, "fetch feeds on loopback and private network addresses")
+		},
+		handler: handlerAgg,
+	})
+	cmds.register(commandInfo{
+		name:        "browse",
+		args:        "[limit]",
+		description: "Outputs the latest unread posts of the feeds you follow, two by default",
+		maxArgs:     1,
+		flags: func(fs *flag.FlagSet) {
+			fs.Bool("all", false, "include read posts")
+			fs.Bool("unread", true, "show only unread posts")
+			fs.String("feed", "", "show only posts of the feed with this `URL or name`")
+			fs.String("since", "", "show only posts published at or after this `time`")
+			fs.String("until", "", "show only posts published before this `time`")
+			fs.String("sort", "desc", "order by publish date, `asc or desc`")
+			fs.Int("offset", 0, "skip this `number` of posts")
+			fs.Int("page", 0, "show this `page number` of posts, counting from 1")
+			fs.String("after", "", "show posts that come after the post with this `ID`")
+		},
+		handler: handlerBrowse,
+	})
+	cmds.register(commandInfo{
+		name:        "read",
+		args:        "<post-id>",
+		description: "Marks a post as read",
+		minArgs:     1,
+		maxArgs:     1,
+		handler:     handlerRead,
+	})
+	cmds.register(commandInfo{
+		name:        "unread",
+		args:        "<post-id>",
+		description: "Marks a post as unread",
+		minArgs:     1,
+		maxArgs:     1,
+		handler:     handlerUnread,
+	})
+	cmds.register(commandInfo{
+		name:        "mark-all-read",
+		args:        "[URL]",
+		description: "Marks all posts of the followed feeds, or only of the given feed, as read",
+		maxArgs:     1,
+		handler:     handlerMarkAllRead,
+	})
+	cmds.register(commandInfo{
+		name:        "star",
+		args:        "<post-id>",
+		description: "Stars a post to keep it for later",
+		minArgs:     1,
+		maxArgs:     1,
+		handler:     handlerStar,
+	})
+	cmds.register(commandInfo{
+		name:        "unstar",
+		args:        "<post-id>",
+		description: "Removes the star from a post",
+		minArgs:     1,
+		maxArgs:     1,
+		handler:     handlerUnstar,
+	})
+	cmds.register(commandInfo{
+		name:        "starred",
+		description: "Lists your starred posts",
+		handler:     handlerStarred,
+	})
+	cmds.register(commandInfo{
+		name:            "search",
+		args:            "<query>...",
+		description:     "Searches the titles and descriptions of posts in the feeds you follow",
+		minArgs:         1,
+		maxArgs:         -1,
+		flagsBeforeArgs: true,
+		handler:         handlerSearch,
+	})
+	cmds.register(commandInfo{
+		name:        "import",
+		args:        "<file.opml>",
+		description: "Adds and follows the feeds listed in an OPML file",
+		minArgs:     1,
+		maxArgs:     1,
+		handler:     handlerImport,
+	})
+	cmds.register(commandInfo{
+		name:        "export",
+		args:        "[file.opml]",
+		description: "Writes the feeds you follow as OPML to a file or standard output",
+		maxArgs:     1,
+		handler:     handlerExport,
+	})
+	cmds.register(commandInfo{
+		name:        "apikey",
+		args:        "<action> [name|id]",
+		description: "Manages your API keys for the serve API: create [name], list, or revoke <id>",
+		minArgs:     1,
+		maxArgs:     -1,
+		handler:     handlerAPIKey,
+	})
+	cmds.register(commandInfo{
+		name:        "serve",
+		description: "Serves a JSON API and the Fever API, authenticated with API keys, until interrupted",
+		flags: func(fs *flag.FlagSet) {
+			fs.String("addr", ":8080", "listen on this `address`")
+			fs.Bool("allow-private-feeds", false, "let API clients add feeds on loopback and private network addresses")
+		},
+		handler: handlerServe,
+	})
+	cmds.register(commandInfo{
+		name:            "migrate",
+		args:            "up|down|status",
+		description:     "Applies all pending database migrations, rolls back the latest one, or lists them",
+		minArgs:         1,
+		maxArgs:         1,
+		skipSchemaCheck: true,
+		handler:         handlerMigrate,
+	})
+	cmds.register(commandInfo{
+		name:            "help",
+		args:            "[command]",
+		description:     "Prints the list of commands, or details on a command",
+		maxArgs:         1,
+		skipSchemaCheck: true,
+		handler:         cmds.handlerHelp,
+	})
+	return cmds
+}
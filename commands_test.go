@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHelp(t *testing.T) {
+	s := newTestState(t)
+
+	out := mustRun(t, s, "help")
+	assertContains(t, out,
+		"Usage:\n  gator <command> [arguments]",
+		"browse [limit] [flags]",
+		"migrate up|down|status",
+		"Global flags:",
+		`Run "gator help <command>"`,
+	)
+	for _, name := range newCommands().names {
+		assertContains(t, out, "\n  "+name)
+	}
+
+	out = mustRun(t, s, "help", "browse")
+	assertContains(t, out, "Usage: gator browse [limit] [flags]", "Flags:", "-sort", "Global flags:", "-output")
+	if out != mustRun(t, s, "browse", "--help") {
+		t.Errorf("browse --help differs from help browse:\n%s", out)
+	}
+	if out := mustRun(t, s, "users", "-h"); !strings.HasPrefix(out, "Usage: gator users\n") || strings.Contains(out, "\nFlags:") {
+		t.Errorf("Unexpected help for users:\n%s", out)
+	}
+
+	_, err := runCommand(t, s, "help", "brwose")
+	if err == nil || !strings.Contains(err.Error(), `Command "brwose" does not exist. Did you mean browse?`) {
+		t.Errorf("help of an unknown command returned %v", err)
+	}
+	_, err = runCommand(t, s, "help", "browse", "feeds")
+	if err == nil || !strings.Contains(err.Error(), "Usage: gator help [command]") {
+		t.Errorf("help with two arguments returned %v", err)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	s := newTestState(t)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"folow", "Did you mean follow?"},
+		{"follo", "Did you mean follow or following?"},
+		{"xyzzy", `Command "xyzzy" does not exist.` + "\n"},
+	}
+	for _, tt := range tests {
+		_, err := runCommand(t, s, tt.name)
+		if err == nil || !strings.Contains(err.Error(), tt.want) || !strings.Contains(err.Error(), `Run "gator help"`) {
+			t.Errorf("gator %s returned %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// UTC offsets in seconds for zone abbreviations seen in feeds. Go only knows
+// the offsets of abbreviations used by the local time zone, and parses any
+// other abbreviation as UTC.
+var zoneOffsets = map[string]int{
+	"GMT":  0,
+	"UTC":  0,
+	"UT":   0,
+	"Z":    0,
+	"WET":  0,
+	"BST":  1 * 3600,
+	"CET":  1 * 3600,
+	"CEST": 2 * 3600,
+	"EET":  2 * 3600,
+	"EEST": 3 * 3600,
+	"MSK":  3 * 3600,
+	"IST":  5*3600 + 1800,
+	"JST":  9 * 3600,
+	"AEST": 10 * 3600,
+	"AEDT": 11 * 3600,
+	"NZST": 12 * 3600,
+	"NZDT": 13 * 3600,
+	"AST":  -4 * 3600,
+	"ADT":  -3 * 3600,
+	"EST":  -5 * 3600,
+	"EDT":  -4 * 3600,
+	"CST":  -6 * 3600,
+	"CDT":  -5 * 3600,
+	"MST":  -7 * 3600,
+	"MDT":  -6 * 3600,
+	"PST":  -8 * 3600,
+	"PDT":  -7 * 3600,
+	"AKST": -9 * 3600,
+	"AKDT": -8 * 3600,
+	"HST":  -10 * 3600,
+}
+
+// Matches a leading day of week such as "Mon, " or "Tuesday,"
+var weekdayPrefix = regexp.MustCompile(`^[A-Za-z]+,\s*`)
+
+// Matches a trailing zone abbreviation that Go's MST layout does not accept
+var shortZoneSuffix = regexp.MustCompile(` (UT|Z)$`)
+
+var timeFormats = buildTimeFormats()
+
+// Builds the list of layouts tried by parseTime. Dates in the RFC 822 family
+// are tried with one or two digit days, two or four digit years, with or
+// without seconds and with numeric, named or missing zones.
+func buildTimeFormats() []string {
+	formats := []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04:05Z07:00",
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02 15:04:05 MST",
+		// W3C-DTF variants used by Dublin Core dc:date
+		"2006-01-02T15:04Z07:00",
+		"2006-01-02",
+		"Mon Jan 2 15:04:05 -0700 MST 2006",
+		time.UnixDate,
+		time.RubyDate,
+	}
+	for _, month := range []string{"Jan", "January"} {
+		for _, year := range []string{"2006", "06"} {
+			for _, clock := range []string{"15:04:05", "15:04"} {
+				for _, zone := range []string{"-0700", "-07:00", "MST", "-0700 MST", ""} {
+					format := strings.TrimSpace(fmt.Sprintf("2 %s %s %s %s", month, year, clock, zone))
+					formats = append(formats, format)
+				}
+			}
+		}
+	}
+	return formats
+}
+
+// Parses the date formats found in real-world feeds. Times without a zone
+// are taken to be in UTC, and all times are returned in UTC because
+// posts.published_at is stored without a time zone.
+func parseTime(timeStr string) (time.Time, error) {
+	normalized := strings.Join(strings.Fields(timeStr), " ")
+	if normalized == "" {
+		return time.Time{}, errors.New("Empty time string")
+	}
+	normalized = weekdayPrefix.ReplaceAllString(normalized, "")
+	normalized = shortZoneSuffix.ReplaceAllString(normalized, " UTC")
+	for _, format := range timeFormats {
+		t, err := time.ParseInLocation(format, normalized, time.UTC)
+		if err == nil {
+			return fixZoneOffset(t).UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Could not parse time: %s", timeStr)
+}
+
+// Applies the offset of a known zone abbreviation that Go parsed as UTC
+func fixZoneOffset(t time.Time) time.Time {
+	name, offset := t.Zone()
+	known, ok := zoneOffsets[strings.ToUpper(name)]
+	if offset != 0 || !ok || known == 0 {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.FixedZone(name, known))
+}
+
+// Returns the publish date of an item, falling back to the updated and
+// Dublin Core dates. Reports false if none of them can be parsed.
+func itemPublishedAt(item RSSItem) (time.Time, bool) {
+	for _, timeStr := range []string{item.PubDate, item.Updated, item.DCDate} {
+		if timeStr == "" {
+			continue
+		}
+		t, err := parseTime(timeStr)
+		if err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
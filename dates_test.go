@@ -0,0 +1,203 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		// RFC 822 dates as used by RSS 2.0
+		{"Mon, 02 Jan 2006 15:04:05 -0700", "2006-01-02T22:04:05Z"},
+		{"Tue, 10 Jun 2003 04:00:00 GMT", "2003-06-10T04:00:00Z"},
+		{"Sat, 07 Sep 2002 00:00:01 UT", "2002-09-07T00:00:01Z"},
+		{"Sat, 07 Sep 2002 00:00:01 Z", "2002-09-07T00:00:01Z"},
+		{"Wed, 02 Oct 2002 13:00:00 GMT", "2002-10-02T13:00:00Z"},
+		{"Fri, 20 Dec 2019 9:30:00 +0100", "2019-12-20T08:30:00Z"},
+		// Zone abbreviations that Go would parse as UTC
+		{"Mon, 2 Jan 2006 15:04:05 PST", "2006-01-02T23:04:05Z"},
+		{"Thu, 14 Jul 2022 08:15:00 EDT", "2022-07-14T12:15:00Z"},
+		{"Sun, 3 Mar 2024 18:00:00 CEST", "2024-03-03T16:00:00Z"},
+		{"Sun, 3 Mar 2024 18:00:00 IST", "2024-03-03T12:30:00Z"},
+		{"3 Mar 2024 18:00:00 +0100 CET", "2024-03-03T17:00:00Z"},
+		// Single-digit days, two-digit years and missing seconds
+		{"Mon, 2 Jan 2006 15:04:05 +0000", "2006-01-02T15:04:05Z"},
+		{"2 Jan 06 15:04:05 GMT", "2006-01-02T15:04:05Z"},
+		{"Thu, 01 Apr 21 10:30 +0200", "2021-04-01T08:30:00Z"},
+		{"Mon, 5 Feb 2018 07:45 EST", "2018-02-05T12:45:00Z"},
+		// Full month and weekday names, odd whitespace and missing zones
+		{"Tuesday, 10 June 2003 04:00:00 +0000", "2003-06-10T04:00:00Z"},
+		{"  Wed,  02 Oct 2002\t08:00:00   EST ", "2002-10-02T13:00:00Z"},
+		{"10 Jun 2003 04:00:00", "2003-06-10T04:00:00Z"},
+		// W3C-DTF dates as used by Atom and Dublin Core dc:date
+		{"2003-12-13T18:30:02Z", "2003-12-13T18:30:02Z"},
+		{"2003-12-13T18:30:02.25+01:00", "2003-12-13T17:30:02.25Z"},
+		{"2003-12-13T18:30+01:00", "2003-12-13T17:30:00Z"},
+		{"2003-12-13T18:30:02", "2003-12-13T18:30:02Z"},
+		{"2003-12-13", "2003-12-13T00:00:00Z"},
+		{"2003-12-13 18:30:02 -0500", "2003-12-13T23:30:02Z"},
+		// Unix date output
+		{"Mon Jan 2 15:04:05 -0700 MST 2006", "2006-01-02T22:04:05Z"},
+	}
+	for _, tt := range tests {
+		got, err := parseTime(tt.input)
+		if err != nil {
+			t.Errorf("parseTime(%q) returned error: %v", tt.input, err)
+			continue
+		}
+		want, err := time.Parse(time.RFC3339Nano, tt.want)
+		if err != nil {
+			t.Fatalf("Invalid expected time %q: %v", tt.want, err)
+		}
+		if !got.Equal(want) {
+			t.Errorf("parseTime(%q) = %s, want %s", tt.input, got.UTC().Format(time.RFC3339Nano), tt.want)
+		}
+		// Times are returned in UTC because the Postgres column has no zone
+		if got.Location() != time.UTC {
+			t.Errorf("parseTime(%q) is in %s, want UTC", tt.input, got.Location())
+		}
+	}
+}
+
+func TestParseTimeInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"yesterday",
+		"Mon, 2 Jan 2006",
+		"32 Jan 2006 10:00:00 GMT",
+		"2 Foo 2006 10:00:00 GMT",
+		"2006-13-01",
+		"2006-01-02T25:00:00Z",
+		"1136214245",
+	}
+	for _, input := range tests {
+		if got, err := parseTime(input); err == nil {
+			t.Errorf("parseTime(%q) = %s, want error", input, got)
+		}
+	}
+}
+
+func TestFixZoneOffset(t *testing.T) {
+	tests := []struct {
+		zone   string
+		offset int
+		want   int
+	}{
+		// Abbreviations Go parsed as UTC get their real offset
+		{"PST", 0, -8 * 3600},
+		{"pst", 0, -8 * 3600},
+		{"EST", 0, -5 * 3600},
+		{"CEST", 0, 2 * 3600},
+		{"IST", 0, 5*3600 + 1800},
+		{"NZDT", 0, 13 * 3600},
+		// UTC zones and unknown abbreviations keep offset 0
+		{"GMT", 0, 0},
+		{"UTC", 0, 0},
+		{"XYZ", 0, 0},
+		{"", 0, 0},
+		// Offsets Go already knows are left alone
+		{"EST", -5 * 3600, -5 * 3600},
+		{"PDT", -7 * 3600, -7 * 3600},
+		{"", 3600, 3600},
+	}
+	for _, tt := range tests {
+		in := time.Date(2024, time.March, 3, 18, 0, 0, 0, time.FixedZone(tt.zone, tt.offset))
+		got := fixZoneOffset(in)
+		name, offset := got.Zone()
+		if offset != tt.want {
+			t.Errorf("fixZoneOffset(%s %d) has offset %d, want %d", tt.zone, tt.offset, offset, tt.want)
+		}
+		if name != tt.zone {
+			t.Errorf("fixZoneOffset(%s %d) has zone %q, want %q", tt.zone, tt.offset, name, tt.zone)
+		}
+		// The wall clock is kept, only the offset changes
+		if got.Hour() != 18 || got.Minute() != 0 || got.Day() != 3 {
+			t.Errorf("fixZoneOffset(%s %d) changed the wall clock to %s", tt.zone, tt.offset, got)
+		}
+	}
+}
+
+func TestItemPublishedAt(t *testing.T) {
+	const (
+		pubDate = "Mon, 02 Jan 2006 15:04:05 GMT"
+		updated = "2007-03-04T05:06:07Z"
+		dcDate  = "2008-05-06T07:08:09+00:00"
+	)
+	tests := []struct {
+		name string
+		item RSSItem
+		want string
+		ok   bool
+	}{
+		{"pubDate first", RSSItem{PubDate: pubDate, Updated: updated, DCDate: dcDate}, "2006-01-02T15:04:05Z", true},
+		{"updated without pubDate", RSSItem{Updated: updated, DCDate: dcDate}, "2007-03-04T05:06:07Z", true},
+		{"dc:date only", RSSItem{DCDate: dcDate}, "2008-05-06T07:08:09Z", true},
+		{"invalid pubDate falls back", RSSItem{PubDate: "soon", Updated: updated}, "2007-03-04T05:06:07Z", true},
+		{"invalid pubDate and updated", RSSItem{PubDate: "soon", Updated: "later", DCDate: dcDate}, "2008-05-06T07:08:09Z", true},
+		{"no dates", RSSItem{}, "", false},
+		{"no valid dates", RSSItem{PubDate: "soon", Updated: "later", DCDate: "never"}, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := itemPublishedAt(tt.item)
+		if ok != tt.ok {
+			t.Errorf("%s: itemPublishedAt reported %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		want, _ := time.Parse(time.RFC3339, tt.want)
+		if !got.Equal(want) {
+			t.Errorf("%s: itemPublishedAt = %s, want %s", tt.name, got.UTC().Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+func TestPublishedAtStoredInUTC(t *testing.T) {
+	const feed = `<?xml version="1.0"?>
+<rss version="2.0">
+<channel>
+  <title>West coast blog</title>
+  <link>https://west.example.com/</link>
+  <item>
+    <title>Morning post</title>
+    <link>https://west.example.com/morning</link>
+    <pubDate>Mon, 2 Jan 2023 08:00:00 PST</pubDate>
+  </item>
+  <item>
+    <title>Offset post</title>
+    <link>https://west.example.com/offset</link>
+    <pubDate>Mon, 2 Jan 2023 09:00:00 -0800</pubDate>
+  </item>
+  <item>
+    <title>Undated post</title>
+    <link>https://west.example.com/undated</link>
+  </item>
+</channel>
+</rss>`
+	s, _ := newFetchTest(t, &feedHandler{body: feed})
+	fetchFeeds(t, s)
+
+	// published_at has no time zone in Postgres, so the stored wall clock
+	// must be the UTC instant
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Morning post", "2023-01-02T16:00:00Z"},
+		{"Offset post", "2023-01-02T17:00:00Z"},
+	}
+	for _, tt := range tests {
+		got := postByTitle(t, s, tt.title).PublishedAt
+		if got.Location() != time.UTC || got.Format(time.RFC3339) != tt.want {
+			t.Errorf("%q was stored as %s, want %s", tt.title, got, tt.want)
+		}
+	}
+	if got := postByTitle(t, s, "Undated post").PublishedAt; got.Location() != time.UTC {
+		t.Errorf("Fetch time was stored as %s, want UTC", got)
+	}
+}
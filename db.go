@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mhiillos/gator/internal/database"
+	"github.com/mhiillos/gator/internal/database/sqlite"
+	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
+)
+
+// A database gator can store its data in, selected by the scheme of db_url
+type backend struct {
+	driver  string
+	dialect goose.Dialect
+	// Directory of the backend's migrations in embeddedMigrations
+	migrations string
+	querier    func(db *sql.DB) database.Querier
+}
+
+var postgresBackend = backend{
+	driver:     "postgres",
+	dialect:    goose.DialectPostgres,
+	migrations: "sql/schema",
+	querier: func(db *sql.DB) database.Querier {
+		return database.New(db)
+	},
+}
+
+var sqliteBackend = backend{
+	driver:     "sqlite",
+	dialect:    goose.DialectSQLite3,
+	migrations: "sql/sqlite/schema",
+	querier: func(db *sql.DB) database.Querier {
+		return sqlite.NewQuerier(db)
+	},
+}
+
+// Connection settings for SQLite databases: enforce foreign keys, wait for
+// other gator processes instead of failing when the database is locked, and
+// let readers work while agg writes
+const sqlitePragmas = "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+// Opens the database at the given URL. URLs starting with sqlite: refer to a
+// SQLite database file, e.g. sqlite://~/.gator.db, and all others to a
+// PostgreSQL database.
+func openDatabase(dbURL string) (*sql.DB, backend, error) {
+	path, ok := strings.CutPrefix(dbURL, "sqlite:")
+	if !ok {
+		db, err := sql.Open(postgresBackend.driver, dbURL)
+		return db, postgresBackend, err
+	}
+	path = strings.TrimPrefix(path, "//")
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, sqliteBackend, err
+		}
+		path = filepath.Join(home, rest)
+	}
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open(sqliteBackend.driver, "file:"+path+separator+sqlitePragmas)
+	return db, sqliteBackend, err
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Returned by parseFeed when the document is a web page instead of a feed
+var errHTMLPage = errors.New("Document is an HTML page, not a feed")
+
+// Feed types advertised in <link rel="alternate"> tags
+var feedLinkTypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/feed+json",
+	"application/rdf+xml",
+}
+
+// Paths where sites commonly serve their feed, tried when a page does not
+// advertise one
+var commonFeedPaths = []string{
+	"/feed",
+	"/rss.xml",
+	"/atom.xml",
+	"/feed.xml",
+	"/index.xml",
+}
+
+// Client for fetching documents from any address, used when adding feeds from
+// the command line and with --allow-private-feeds. Requests give up well
+// before the claim on a feed being fetched expires.
+var documentClient = &http.Client{Timeout: feedClaimLease / 5}
+
+// Shared address space for carrier-grade NAT (RFC 6598), which is not
+// routable on the internet
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Returns a client that only connects to public addresses, for fetching feeds
+// and the URLs API clients submit without letting them reach the server's own
+// network. The address is checked when connecting, so redirects and host
+// names that resolve to private addresses are refused as well.
+func newPublicDocumentClient() *http.Client {
+	return newRestrictedClient(func(addr netip.AddrPort) bool {
+		return isPublicAddr(addr.Addr())
+	})
+}
+
+// Returns a client that only connects to the addresses allowed reports true
+// for
+func newRestrictedClient(allowed func(addr netip.AddrPort) bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, conn syscall.RawConn) error {
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !allowed(addr) {
+				return fmt.Errorf("Refusing to fetch from non-public address %s", addr.Addr())
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   feedClaimLease / 5,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+}
+
+// Reports whether the address is routable on the internet
+func isPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !sharedAddressSpace.Contains(ip)
+}
+
+// Downloads a document and returns its body and content type
+func fetchDocument(ctx context.Context, client *http.Client, docURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", docURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("user-agent", "gator")
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error fetching %s: %w", docURL, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return nil, "", fmt.Errorf("Error fetching %s with status %d", docURL, res.StatusCode)
+	}
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", errors.New("Error reading bytes from response")
+	}
+	return raw, res.Header.Get("Content-Type"), nil
+}
+
+// Returns the feed URLs advertised in the head of an HTML page, resolved
+// against the page URL
+func feedLinks(raw []byte, base *url.URL) []string {
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+	links := []string{}
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return links
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(start.Name.Local, "body") {
+			return links
+		}
+		if !strings.EqualFold(start.Name.Local, "link") {
+			continue
+		}
+		attrs := map[string]string{}
+		for _, attr := range start.Attr {
+			attrs[strings.ToLower(attr.Name.Local)] = strings.TrimSpace(attr.Value)
+		}
+		rels := strings.Fields(strings.ToLower(attrs["rel"]))
+		if attrs["href"] == "" || !containsString(rels, "alternate") {
+			continue
+		}
+		if !containsString(feedLinkTypes, strings.ToLower(attrs["type"])) {
+			continue
+		}
+		href, err := base.Parse(attrs["href"])
+		if err != nil {
+			continue
+		}
+		links = append(links, href.String())
+	}
+}
+
+func containsString(list []string, str string) bool {
+	for _, item := range list {
+		if item == str {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the URL of the feed for the given address, and the feeds the page
+// advertises. Feed URLs are returned as is, while for web pages the feeds
+// advertised by the page and then the common feed paths of the site are
+// tried.
+func discoverFeedURL(ctx context.Context, client *http.Client, pageURL string) (string, []string, error) {
+	raw, contentType, err := fetchDocument(ctx, client, pageURL)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = parseFeed(raw, contentType)
+	if err == nil {
+		return pageURL, nil, nil
+	}
+	if !errors.Is(err, errHTMLPage) {
+		return "", nil, err
+	}
+
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", nil, err
+	}
+	advertised := feedLinks(raw, base)
+	candidates := advertised
+	for _, path := range commonFeedPaths {
+		candidates = append(candidates, base.ResolveReference(&url.URL{Path: path}).String())
+	}
+	for _, candidate := range candidates {
+		raw, contentType, err := fetchDocument(ctx, client, candidate)
+		if err != nil {
+			continue
+		}
+		_, err = parseFeed(raw, contentType)
+		if err == nil {
+			return candidate, advertised, nil
+		}
+	}
+	return "", advertised, fmt.Errorf("No feed found at %s", pageURL)
+}
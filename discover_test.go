@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Starts a site serving the given documents by path. HTML pages are the
+// documents starting with "<html".
+func newDiscoverServer(t *testing.T, docs map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasPrefix(doc, "<html") {
+			w.Header().Set("Content-Type", "text/html")
+		} else {
+			w.Header().Set("Content-Type", "application/xml")
+		}
+		io.WriteString(w, doc)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDiscoverFeedURL(t *testing.T) {
+	tests := []struct {
+		name string
+		docs map[string]string
+		path string
+		// Paths of the discovered and advertised feeds, or "" for an error
+		want       string
+		advertised []string
+	}{
+		{
+			name: "feed URL",
+			docs: map[string]string{"/blog/rss.xml": blogFeed},
+			path: "/blog/rss.xml",
+			want: "/blog/rss.xml",
+		},
+		{
+			name: "alternate link",
+			docs: map[string]string{
+				"/blog/": `<html><head><title>Blog</title>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="Posts" href="posts.xml">
+</head><body></body></html>`,
+				"/blog/posts.xml": blogFeed,
+			},
+			path:       "/blog/",
+			want:       "/blog/posts.xml",
+			advertised: []string{"/blog/posts.xml"},
+		},
+		{
+			name: "several advertised feeds",
+			docs: map[string]string{
+				"/": `<html><head>
+<link rel="alternate" type="application/atom+xml" href="/news.xml">
+<link rel="alternate" type="application/rss+xml" href="/rss.xml">
+</head><body></body></html>`,
+				"/news.xml": newsFeed,
+				"/rss.xml":  blogFeed,
+			},
+			path:       "/",
+			want:       "/news.xml",
+			advertised: []string{"/news.xml", "/rss.xml"},
+		},
+		{
+			name: "broken advertised feed",
+			docs: map[string]string{
+				"/": `<html><head>
+<link rel="alternate" type="application/rss+xml" href="/missing.xml">
+<link rel="alternate" type="application/rss+xml" href="/rss.xml">
+</head><body></body></html>`,
+				"/rss.xml": blogFeed,
+			},
+			path:       "/",
+			want:       "/rss.xml",
+			advertised: []string{"/missing.xml", "/rss.xml"},
+		},
+		{
+			name: "common feed path",
+			docs: map[string]string{
+				"/about": `<html><head><title>About</title></head><body></body></html>`,
+				"/atom.xml": `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Site</title></feed>`,
+			},
+			path: "/about",
+			want: "/atom.xml",
+		},
+		{
+			name: "links in the body are ignored",
+			docs: map[string]string{
+				"/": `<html><head><title>Blog</title></head><body>
+<link rel="alternate" type="application/rss+xml" href="/rss.xml">
+</body></html>`,
+				"/other.xml": blogFeed,
+			},
+			path: "/",
+		},
+		{
+			name: "no feed",
+			docs: map[string]string{"/": `<html><head><title>Blog</title></head><body></body></html>`},
+			path: "/",
+		},
+		{
+			name: "unreachable",
+			docs: map[string]string{},
+			path: "/rss.xml",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newDiscoverServer(t, tt.docs)
+			got, advertised, err := discoverFeedURL(context.Background(), documentClient, srv.URL+tt.path)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("Discovered %s, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != srv.URL+tt.want {
+				t.Errorf("Discovered %s, want %s", got, srv.URL+tt.want)
+			}
+			want := []string{}
+			for _, path := range tt.advertised {
+				want = append(want, srv.URL+path)
+			}
+			if !slices.Equal(advertised, want) {
+				t.Errorf("Advertised feeds %q, want %q", advertised, want)
+			}
+		})
+	}
+}
+
+func TestFeedLinks(t *testing.T) {
+	const page = `<!DOCTYPE html>
+<html><head>
+<meta charset="utf-8">
+<LINK REL="Alternate" TYPE="Application/RSS+XML" HREF="/rss.xml">
+<link rel="alternate" type="application/atom+xml" href="https://feeds.example.com/atom">
+<link rel="alternate home" type="application/feed+json" href="feed.json">
+<link rel="alternate" type="application/rdf+xml" href="index.rdf">
+<link rel="alternate" type="text/html" hreflang="fi" href="/fi/">
+<link rel="alternate" type="application/rss+xml">
+<link rel="feed" type="application/rss+xml" href="/other.xml">
+<link rel="stylesheet" type="text/css" href="/style.css">
+</head><body>
+<link rel="alternate" type="application/rss+xml" href="/body.xml">
+</body></html>`
+	base, err := url.Parse("https://blog.example.com/posts/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := feedLinks([]byte(page), base)
+	want := []string{
+		"https://blog.example.com/rss.xml",
+		"https://feeds.example.com/atom",
+		"https://blog.example.com/posts/feed.json",
+		"https://blog.example.com/posts/index.rdf",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("feedLinks = %q, want %q", got, want)
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"93.184.216.34", true},
+		{"2606:4700::1111", true},
+		{"100.63.255.255", true},
+		{"100.128.0.1", true},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"127.0.0.1", false},
+		{"0.0.0.0", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"100.127.255.255", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:100.64.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
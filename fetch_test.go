@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mhiillos/gator/internal/database"
+)
+
+// Serves a feed that tests can change, answering conditional requests like a
+// web server does
+type feedHandler struct {
+	mu           sync.Mutex
+	body         string
+	etag         string
+	lastModified string
+	// Status returned instead of the feed when not zero
+	status int
+	// Location header sent with the status, for redirects
+	location string
+	hits     int
+	// Validators sent with the latest request
+	ifNoneMatch     string
+	ifModifiedSince string
+}
+
+func (h *feedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hits++
+	h.ifNoneMatch = r.Header.Get("If-None-Match")
+	h.ifModifiedSince = r.Header.Get("If-Modified-Since")
+	if h.status != 0 {
+		if h.location != "" {
+			w.Header().Set("Location", h.location)
+		}
+		w.WriteHeader(h.status)
+		return
+	}
+	if (h.etag != "" && h.ifNoneMatch == h.etag) || (h.lastModified != "" && h.ifModifiedSince == h.lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if h.etag != "" {
+		w.Header().Set("ETag", h.etag)
+	}
+	if h.lastModified != "" {
+		w.Header().Set("Last-Modified", h.lastModified)
+	}
+	w.Header().Set("Content-Type", "application/rss+xml")
+	w.Write([]byte(h.body))
+}
+
+// Changes the served feed while holding the lock
+func (h *feedHandler) update(fn func(h *feedHandler)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fn(h)
+}
+
+// Returns the number of requests and the validators of the latest one, and
+// resets the count
+func (h *feedHandler) takeHits() (int, string, string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hits := h.hits
+	h.hits = 0
+	return hits, h.ifNoneMatch, h.ifModifiedSince
+}
+
+// Registers alice and adds a feed served by h for her
+func newFetchTest(t *testing.T, h *feedHandler) (*state, string) {
+	t.Helper()
+	s := newTestState(t)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	mustRun(t, s, "register", "alice")
+	mustRun(t, s, "addfeed", "Go blog", srv.URL+"/feed.xml")
+	h.takeHits()
+	return s, srv.URL + "/feed.xml"
+}
+
+func getFeed(t *testing.T, s *state, url string) database.Feed {
+	t.Helper()
+	feed, err := s.db.GetFeedByUrl(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+// Adds an item to the blog feed
+func blogFeedWith(title string) string {
+	return strings.Replace(blogFeed, "</channel>", `  <item>
+    <title>`+title+`</title>
+    <link>https://blog.example.com/`+strings.ToLower(title)+`</link>
+    <pubDate>Fri, 06 Jan 2023 10:00:00 GMT</pubDate>
+  </item>
+</channel>`, 1)
+}
+
+func TestFetchConditionalGet(t *testing.T) {
+	const lastModified = "Wed, 04 Jan 2023 10:00:00 GMT"
+	h := &feedHandler{body: blogFeed, etag: `"v1"`, lastModified: lastModified}
+	s, url := newFetchTest(t, h)
+
+	fetchFeeds(t, s)
+	if hits, etag, since := h.takeHits(); hits != 1 || etag != "" || since != "" {
+		t.Errorf("First fetch made %d requests with validators %q and %q", hits, etag, since)
+	}
+	feed := getFeed(t, s, url)
+	if feed.Etag.String != `"v1"` || feed.LastModified.String != lastModified {
+		t.Errorf("Stored validators %q and %q", feed.Etag.String, feed.LastModified.String)
+	}
+	assertTitles(t, browseTitles(t, s, "10"), "Fuzzing", "Error handling", "Generics in Go")
+
+	// An unchanged feed is answered with 304 and counts as a success
+	fetchFeeds(t, s)
+	if hits, etag, since := h.takeHits(); hits != 1 || etag != `"v1"` || since != lastModified {
+		t.Errorf("Second fetch made %d requests with validators %q and %q", hits, etag, since)
+	}
+	feed = getFeed(t, s, url)
+	if feed.LastHttpStatus.Int32 != http.StatusNotModified || !feed.LastSuccessAt.Valid || feed.ConsecutiveFailures != 0 {
+		t.Errorf("Unexpected feed health after 304: %+v", feed)
+	}
+	if feed.Etag.String != `"v1"` || feed.LastModified.String != lastModified {
+		t.Errorf("304 changed the validators to %q and %q", feed.Etag.String, feed.LastModified.String)
+	}
+	assertTitles(t, browseTitles(t, s, "10"), "Fuzzing", "Error handling", "Generics in Go")
+
+	// A changed feed is fetched again with its new validators
+	h.update(func(h *feedHandler) {
+		h.body = blogFeedWith("Profiling")
+		h.etag = `"v2"`
+		h.lastModified = "Fri, 06 Jan 2023 10:00:00 GMT"
+	})
+	fetchFeeds(t, s)
+	feed = getFeed(t, s, url)
+	if feed.Etag.String != `"v2"` || feed.LastModified.String != "Fri, 06 Jan 2023 10:00:00 GMT" || feed.LastHttpStatus.Int32 != http.StatusOK {
+		t.Errorf("Unexpected feed after a change: %+v", feed)
+	}
+	assertTitles(t, browseTitles(t, s, "1"), "Profiling")
+
+	// Servers that stop sending validators get unconditional requests
+	h.update(func(h *feedHandler) {
+		h.etag = ""
+		h.lastModified = ""
+	})
+	fetchFeeds(t, s)
+	if feed = getFeed(t, s, url); feed.Etag.Valid || feed.LastModified.Valid {
+		t.Errorf("Validators were kept: %q and %q", feed.Etag.String, feed.LastModified.String)
+	}
+	h.takeHits()
+	fetchFeeds(t, s)
+	if hits, etag, since := h.takeHits(); hits != 1 || etag != "" || since != "" {
+		t.Errorf("Fetch made %d requests with validators %q and %q", hits, etag, since)
+	}
+}
+
+func TestFetchLastModifiedOnly(t *testing.T) {
+	const lastModified = "Wed, 04 Jan 2023 10:00:00 GMT"
+	h := &feedHandler{body: blogFeed, lastModified: lastModified}
+	s, url := newFetchTest(t, h)
+
+	fetchFeeds(t, s)
+	fetchFeeds(t, s)
+	if hits, etag, since := h.takeHits(); hits != 2 || etag != "" || since != lastModified {
+		t.Errorf("Fetches made %d requests, the last with validators %q and %q", hits, etag, since)
+	}
+	if feed := getFeed(t, s, url); feed.LastHttpStatus.Int32 != http.StatusNotModified || feed.Etag.Valid {
+		t.Errorf("Unexpected feed after 304: %+v", feed)
+	}
+}
+
+func TestFetchRoundCoversEveryDueFeed(t *testing.T) {
+	h := &feedHandler{body: blogFeed}
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	s := newTestState(t)
+	mustRun(t, s, "register", "alice")
+	const feeds = 25
+	for i := range feeds {
+		mustRun(t, s, "addfeed", fmt.Sprintf("Feed %d", i), fmt.Sprintf("%s/feed%d.xml", srv.URL, i))
+	}
+	h.takeHits()
+
+	// A single worker still fetches every feed exactly once per round
+	for round := range 2 {
+		_, err := captureStdout(t, func() error {
+			return scrapeFeeds(s, documentClient, 1)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hits, _, _ := h.takeHits(); hits != feeds {
+			t.Errorf("Round %d fetched %d feeds, want %d", round+1, hits, feeds)
+		}
+	}
+}
+
+// Claims every due feed the way another agg process would
+func claimFeeds(t *testing.T, s *state, lease time.Duration) []database.Feed {
+	t.Helper()
+	feeds, err := s.db.ClaimNextFeedsToFetch(context.Background(), database.ClaimNextFeedsToFetchParams{
+		LeaseSeconds:  int32(lease.Seconds()),
+		FetchedBefore: time.Now(),
+		BatchSize:     10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feeds
+}
+
+func TestFetchClaimLease(t *testing.T) {
+	h := &feedHandler{body: blogFeed}
+	s, url := newFetchTest(t, h)
+
+	// A feed leased by another process is skipped
+	if feeds := claimFeeds(t, s, time.Second); len(feeds) != 1 || feeds[0].Url != url {
+		t.Fatalf("Claimed %+v", feeds)
+	}
+	if feed := getFeed(t, s, url); !feed.ClaimedUntil.Valid || !feed.ClaimedUntil.Time.After(time.Now()) {
+		t.Errorf("Claim is not stored: %+v", feed.ClaimedUntil)
+	}
+	if feeds := claimFeeds(t, s, time.Second); len(feeds) != 0 {
+		t.Errorf("Leased feed was claimed again: %+v", feeds)
+	}
+	fetchFeeds(t, s)
+	if hits, _, _ := h.takeHits(); hits != 0 {
+		t.Errorf("Leased feed was fetched %d times", hits)
+	}
+
+	// The lease of a crashed process expires and the feed is fetched again
+	time.Sleep(1100 * time.Millisecond)
+	fetchFeeds(t, s)
+	if hits, _, _ := h.takeHits(); hits != 1 {
+		t.Errorf("Feed with an expired lease was fetched %d times", hits)
+	}
+
+	// Fetching releases the claim
+	if feed := getFeed(t, s, url); feed.ClaimedUntil.Valid || !feed.LastFetchedAt.Valid {
+		t.Errorf("Unexpected feed after fetching: %+v", feed)
+	}
+	if feeds := claimFeeds(t, s, time.Second); len(feeds) != 1 {
+		t.Errorf("Released feed could not be claimed: %+v", feeds)
+	}
+}
+
+func TestFeedBackoff(t *testing.T) {
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{3, 8 * time.Minute},
+		{10, 1024 * time.Minute},
+		{11, maxFeedBackoff},
+		{21, maxFeedBackoff},
+		{1000, maxFeedBackoff},
+	}
+	for _, tt := range tests {
+		if got := feedBackoff(tt.failures); got != tt.want {
+			t.Errorf("feedBackoff(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// Fetches a single feed right away, ignoring its backoff
+func retryFeed(t *testing.T, s *state, url string) error {
+	t.Helper()
+	_, err := captureStdout(t, func() error {
+		return scrapeFeed(s, documentClient, getFeed(t, s, url))
+	})
+	return err
+}
+
+func TestFetchFailures(t *testing.T) {
+	h := &feedHandler{body: blogFeed}
+	s, url := newFetchTest(t, h)
+	s.cfg.MaxFeedFailures = 3
+	h.update(func(h *feedHandler) { h.status = http.StatusInternalServerError })
+
+	// A failing feed is backed off and not fetched again by the next round
+	fetchFeeds(t, s)
+	feed := getFeed(t, s, url)
+	if feed.ConsecutiveFailures != 1 || feed.Disabled || feed.LastHttpStatus.Int32 != http.StatusInternalServerError || !feed.LastError.Valid {
+		t.Errorf("Unexpected feed after a failure: %+v", feed)
+	}
+	if !feed.RetryAfter.Valid || feed.RetryAfter.Time.Before(time.Now().Add(feedBackoff(0)-time.Second)) {
+		t.Errorf("Feed is retried at %v", feed.RetryAfter)
+	}
+	fetchFeeds(t, s)
+	if hits, _, _ := h.takeHits(); hits != 1 {
+		t.Errorf("Backed off feed was fetched %d times", hits)
+	}
+	assertContains(t, mustRun(t, s, "feeds"), "FAILING", "consecutive failures: 1", "last HTTP status: 500")
+
+	// Each failure doubles the backoff until the feed is disabled
+	if err := retryFeed(t, s, url); err == nil {
+		t.Fatal("Retrying a failing feed succeeded")
+	}
+	feed = getFeed(t, s, url)
+	if feed.ConsecutiveFailures != 2 || feed.Disabled || feed.RetryAfter.Time.Before(time.Now().Add(feedBackoff(1)-time.Second)) {
+		t.Errorf("Unexpected feed after two failures: %+v", feed)
+	}
+	retryFeed(t, s, url)
+	if feed = getFeed(t, s, url); feed.ConsecutiveFailures != 3 || !feed.Disabled {
+		t.Errorf("Feed was not disabled after %d failures: %+v", s.cfg.MaxFeedFailures, feed)
+	}
+	assertContains(t, mustRun(t, s, "feeds"), "DISABLED", "consecutive failures: 3")
+
+	// A disabled feed is not fetched even once its backoff has passed
+	_, err := s.db.RecordFeedFailure(context.Background(), database.RecordFeedFailureParams{
+		LastError:   sql.NullString{String: "Server error", Valid: true},
+		MaxFailures: 1,
+		ID:          feed.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.takeHits()
+	fetchFeeds(t, s)
+	if hits, _, _ := h.takeHits(); hits != 0 {
+		t.Errorf("Disabled feed was fetched %d times", hits)
+	}
+
+	// enablefeed clears the failures and the feed is fetched again
+	h.update(func(h *feedHandler) { h.status = 0 })
+	assertContains(t, mustRun(t, s, "enablefeed", url), "Feed Go blog enabled")
+	feed = getFeed(t, s, url)
+	if feed.Disabled || feed.ConsecutiveFailures != 0 || feed.RetryAfter.Valid {
+		t.Errorf("Unexpected feed after enablefeed: %+v", feed)
+	}
+	fetchFeeds(t, s)
+	if hits, _, _ := h.takeHits(); hits != 1 {
+		t.Errorf("Enabled feed was fetched %d times", hits)
+	}
+	feed = getFeed(t, s, url)
+	if feed.LastHttpStatus.Int32 != http.StatusOK || !feed.LastSuccessAt.Valid || feed.ConsecutiveFailures != 0 {
+		t.Errorf("Unexpected feed after recovering: %+v", feed)
+	}
+	assertContains(t, mustRun(t, s, "feeds"), "OK, last success")
+	assertTitles(t, browseTitles(t, s, "10"), "Fuzzing", "Error handling", "Generics in Go")
+}
+
+func TestEnableFeedUnknown(t *testing.T) {
+	s := newTestState(t)
+	mustRun(t, s, "register", "alice")
+	_, err := runCommand(t, s, "enablefeed", "https://example.com/missing.xml")
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("enablefeed of an unknown URL returned %v", err)
+	}
+}
+
+func TestFetchRefusesRedirectToPrivateAddress(t *testing.T) {
+	internal := &feedHandler{body: newsFeed}
+	internalSrv := httptest.NewServer(internal)
+	t.Cleanup(internalSrv.Close)
+	h := &feedHandler{body: blogFeed}
+	s, url := newFetchTest(t, h)
+
+	// Only the feed's server counts as public, so the other server on the
+	// loopback interface stands in for the server's own network
+	public := netip.MustParseAddrPort(strings.TrimSuffix(strings.TrimPrefix(url, "http://"), "/feed.xml"))
+	client := newRestrictedClient(func(addr netip.AddrPort) bool {
+		return addr == public
+	})
+	fetch := func() {
+		t.Helper()
+		_, err := captureStdout(t, func() error {
+			return scrapeFeeds(s, client, 1)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetch()
+	if hits, _, _ := h.takeHits(); hits != 1 {
+		t.Fatalf("Public feed was fetched %d times", hits)
+	}
+
+	// A redirect to the internal server is refused when connecting
+	h.update(func(h *feedHandler) {
+		h.status = http.StatusFound
+		h.location = internalSrv.URL + "/feed.xml"
+	})
+	fetch()
+	if hits, _, _ := h.takeHits(); hits != 1 {
+		t.Errorf("Redirecting feed was fetched %d times", hits)
+	}
+	if hits, _, _ := internal.takeHits(); hits != 0 {
+		t.Errorf("Internal server was reached %d times", hits)
+	}
+	feed := getFeed(t, s, url)
+	if feed.ConsecutiveFailures != 1 || !strings.Contains(feed.LastError.String, "Refusing to fetch from non-public address 127.0.0.1") {
+		t.Errorf("Unexpected feed after a redirect to a private address: %+v", feed)
+	}
+
+	// Without the restriction the redirect is followed
+	if err := retryFeed(t, s, url); err != nil {
+		t.Fatal(err)
+	}
+	if hits, _, _ := internal.takeHits(); hits != 1 {
+		t.Errorf("Internal server was reached %d times without the restriction", hits)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhiillos/gator/internal/database"
+)
+
+// Version of the Fever API implemented by gator
+const feverAPIVersion = 3
+
+// Maximum number of items returned by one Fever items request
+const feverItemsLimit = 50
+
+// gator has no folders, so all followed feeds are in one Fever group
+const feverGroupID = 1
+
+type feverGroup struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type feverFeedsGroup struct {
+	GroupID int64  `json:"group_id"`
+	FeedIDs string `json:"feed_ids"`
+}
+
+type feverFeed struct {
+	ID                int64  `json:"id"`
+	FaviconID         int64  `json:"favicon_id"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	SiteURL           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+type feverItem struct {
+	ID            int64  `json:"id"`
+	FeedID        int64  `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	URL           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// Fever uses 0 and 1 for booleans
+func feverBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func unixTime(t sql.NullTime) int64 {
+	if !t.Valid {
+		return 0
+	}
+	return t.Time.Unix()
+}
+
+// Returns the IDs as a comma-separated list, as Fever sends ID lists
+func joinIDs(ids []int64) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(strs, ",")
+}
+
+// Returns the integer form value, or an invalid NullInt64 if it is not given
+func formInt(form url.Values, name string) (sql.NullInt64, error) {
+	value := form.Get(name)
+	if value == "" {
+		return sql.NullInt64{}, nil
+	}
+	num, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return sql.NullInt64{}, fmt.Errorf("Parameter %s is not a number", name)
+	}
+	return sql.NullInt64{Int64: num, Valid: true}, nil
+}
+
+// Serves the Fever API. Clients authenticate with the api_key form value,
+// the MD5 hash of "username:password", where the password is an API key
+// created with the apikey command. Marking is done before the requested
+// lists are read, so the lists reflect the changes.
+func feverHandler(s *state) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err))
+			return
+		}
+		resp := map[string]any{
+			"api_version": feverAPIVersion,
+			"auth":        0,
+		}
+		apiKey := strings.ToLower(r.Form.Get("api_key"))
+		user, err := s.db.GetUserByFeverKey(r.Context(), hashAPIKey(apiKey))
+		if errors.Is(err, sql.ErrNoRows) {
+			// Fever reports failed authentication in the response body
+			respondWithJSON(w, http.StatusOK, resp)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking API key: %v", err))
+			return
+		}
+		resp["auth"] = 1
+
+		if r.Form.Has("mark") {
+			status, err := feverMark(r.Context(), s, user, r.Form)
+			if err != nil {
+				respondWithError(w, status, err.Error())
+				return
+			}
+		}
+		if status, err := feverRead(r.Context(), s, user, r.Form, resp); err != nil {
+			respondWithError(w, status, err.Error())
+			return
+		}
+		respondWithJSON(w, http.StatusOK, resp)
+	}
+}
+
+// Marks an item as read, unread, saved or unsaved, or all items of a feed or
+// group as read. Unknown items and feeds are ignored, like Fever does.
+func feverMark(ctx context.Context, s *state, user database.User, form url.Values) (int, error) {
+	id, err := formInt(form, "id")
+	if err != nil || !id.Valid {
+		return http.StatusBadRequest, errors.New("Parameter id must be a number")
+	}
+	as := form.Get("as")
+	switch form.Get("mark") {
+	case "item":
+		post, err := s.db.GetPostByFeverID(ctx, id.Int64)
+		if err == nil {
+			// Items of feeds the user does not follow are unknown to them
+			post, err = s.db.GetPostForUser(ctx, database.GetPostForUserParams{ID: post.ID, UserID: user.ID})
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return http.StatusOK, nil
+		}
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Error getting post: %v", err)
+		}
+		switch as {
+		case "read":
+			err = s.db.MarkPostRead(ctx, database.MarkPostReadParams{UserID: user.ID, PostID: post.ID})
+		case "unread":
+			err = s.db.MarkPostUnread(ctx, database.MarkPostUnreadParams{UserID: user.ID, PostID: post.ID})
+		case "saved":
+			err = s.db.StarPost(ctx, database.StarPostParams{UserID: user.ID, PostID: post.ID})
+		case "unsaved":
+			err = s.db.UnstarPost(ctx, database.UnstarPostParams{UserID: user.ID, PostID: post.ID})
+		default:
+			return http.StatusBadRequest, fmt.Errorf("Unknown item state %q", as)
+		}
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Error updating post state: %v", err)
+		}
+	case "feed", "group":
+		if as != "read" {
+			return http.StatusBadRequest, fmt.Errorf("Unknown %s state %q", form.Get("mark"), as)
+		}
+		params := database.MarkAllPostsReadParams{UserID: user.ID}
+		before, err := formInt(form, "before")
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		if before.Valid {
+			params.Before = sql.NullTime{Time: time.Unix(before.Int64, 0), Valid: true}
+		}
+		if form.Get("mark") == "feed" {
+			feed, err := s.db.GetFeedByFeverID(ctx, id.Int64)
+			if errors.Is(err, sql.ErrNoRows) {
+				return http.StatusOK, nil
+			}
+			if err != nil {
+				return http.StatusInternalServerError, fmt.Errorf("Error getting feed: %v", err)
+			}
+			params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+		} else if id.Int64 != 0 && id.Int64 != feverGroupID {
+			// Group 0 is the group of all feeds, and negative groups are
+			// Fever's sparks, which gator does not have
+			return http.StatusOK, nil
+		}
+		_, err = s.db.MarkAllPostsRead(ctx, params)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Error marking posts as read: %v", err)
+		}
+	default:
+		return http.StatusBadRequest, fmt.Errorf("Unknown mark type %q", form.Get("mark"))
+	}
+	return http.StatusOK, nil
+}
+
+// Adds the lists requested by the form to the response
+func feverRead(ctx context.Context, s *state, user database.User, form url.Values, resp map[string]any) (int, error) {
+	feeds, err := s.db.GetFollowedFeeds(ctx, user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Error getting feeds: %v", err)
+	}
+	lastRefreshed := int64(0)
+	feedIDs := []int64{}
+	for _, feed := range feeds {
+		lastRefreshed = max(lastRefreshed, unixTime(feed.LastFetchedAt))
+		feedIDs = append(feedIDs, feed.FeverID)
+	}
+	resp["last_refreshed_on_time"] = lastRefreshed
+	feedsGroups := []feverFeedsGroup{{GroupID: feverGroupID, FeedIDs: joinIDs(feedIDs)}}
+
+	if form.Has("groups") {
+		resp["groups"] = []feverGroup{{ID: feverGroupID, Title: "All"}}
+		resp["feeds_groups"] = feedsGroups
+	}
+	if form.Has("feeds") {
+		records := []feverFeed{}
+		for _, feed := range feeds {
+			records = append(records, feverFeed{
+				ID:                feed.FeverID,
+				Title:             feed.Name,
+				URL:               feed.Url,
+				SiteURL:           feed.Url,
+				LastUpdatedOnTime: unixTime(feed.LastSuccessAt),
+			})
+		}
+		resp["feeds"] = records
+		resp["feeds_groups"] = feedsGroups
+	}
+	if form.Has("favicons") {
+		resp["favicons"] = []any{}
+	}
+	if form.Has("links") {
+		resp["links"] = []any{}
+	}
+	if form.Has("items") {
+		params := database.GetFeverItemsForUserParams{UserID: user.ID, Limit: feverItemsLimit}
+		if params.SinceID, err = formInt(form, "since_id"); err != nil {
+			return http.StatusBadRequest, err
+		}
+		if params.MaxID, err = formInt(form, "max_id"); err != nil {
+			return http.StatusBadRequest, err
+		}
+		if withIDs := form.Get("with_ids"); withIDs != "" {
+			params.WithIds = []int64{}
+			for _, str := range strings.Split(withIDs, ",") {
+				id, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+				if err != nil {
+					return http.StatusBadRequest, fmt.Errorf("Parameter with_ids has an invalid ID %q", str)
+				}
+				params.WithIds = append(params.WithIds, id)
+			}
+		}
+		rows, err := s.db.GetFeverItemsForUser(ctx, params)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Error getting items: %v", err)
+		}
+		items := []feverItem{}
+		for _, row := range rows {
+			items = append(items, feverItem{
+				ID:            row.FeverID,
+				FeedID:        row.FeedFeverID,
+				Title:         row.Title,
+				HTML:          row.Description.String,
+				URL:           row.Url,
+				IsSaved:       feverBool(row.Starred),
+				IsRead:        feverBool(row.Read),
+				CreatedOnTime: row.PublishedAt.Unix(),
+			})
+		}
+		total, err := s.db.CountPostsForUser(ctx, user.ID)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Error counting items: %v", err)
+		}
+		resp["items"] = items
+		resp["total_items"] = total
+	}
+	// Fever returns the changed list after marking items
+	if form.Has("unread_item_ids") || form.Get("mark") == "item" && (form.Get("as") == "read" || form.Get("as") == "unread") {
+		ids, err := s.db.GetUnreadFeverIDs(ctx, user.ID)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Error getting unread items: %v", err)
+		}
+		resp["unread_item_ids"] = joinIDs(ids)
+	}
+	if form.Has("saved_item_ids") || form.Get("mark") == "item" && (form.Get("as") == "saved" || form.Get("as") == "unsaved") {
+		ids, err := s.db.GetStarredFeverIDs(ctx, user.ID)
+		if err != nil {
+			return http.StatusInternalServerError, fmt.Errorf("Error getting saved items: %v", err)
+		}
+		resp["saved_item_ids"] = joinIDs(ids)
+	}
+	return http.StatusOK, nil
+}
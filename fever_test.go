@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type feverResponse struct {
+	APIVersion          int               `json:"api_version"`
+	Auth                int               `json:"auth"`
+	LastRefreshedOnTime int64             `json:"last_refreshed_on_time"`
+	Groups              []feverGroup      `json:"groups"`
+	FeedsGroups         []feverFeedsGroup `json:"feeds_groups"`
+	Feeds               []feverFeed       `json:"feeds"`
+	Items               []feverItem       `json:"items"`
+	TotalItems          int64             `json:"total_items"`
+	UnreadItemIDs       *string           `json:"unread_item_ids"`
+	SavedItemIDs        *string           `json:"saved_item_ids"`
+	Favicons            []any             `json:"favicons"`
+	Links               []any             `json:"links"`
+}
+
+// Returns the blog state with the Fever api_key of an API key for alice and
+// the API routes
+func newFeverTest(t *testing.T) (*state, *httptest.Server, string, http.Handler) {
+	t.Helper()
+	s, srv, key, h := newAPITest(t)
+	return s, srv, feverAPIKey("alice", key), h
+}
+
+// Posts the form with the api_key to the Fever API, as Fever clients do,
+// and returns the response
+func feverRequest(t *testing.T, h http.Handler, apiKey, query string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set("api_key", apiKey)
+	req := httptest.NewRequest("POST", "/fever/?api&"+query, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// Sends a Fever request that must succeed and returns the decoded response
+func feverCall(t *testing.T, h http.Handler, apiKey, query string, form url.Values) feverResponse {
+	t.Helper()
+	rec := feverRequest(t, h, apiKey, query, form)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Fever request %q returned %d: %s", query, rec.Code, rec.Body.String())
+	}
+	var resp feverResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Fever request %q returned invalid JSON: %v\n%s", query, err, rec.Body.String())
+	}
+	if resp.APIVersion != feverAPIVersion {
+		t.Errorf("Got api_version %d, want %d", resp.APIVersion, feverAPIVersion)
+	}
+	return resp
+}
+
+// Returns the Fever ID of the post as a string
+func feverID(t *testing.T, s *state, title string) string {
+	t.Helper()
+	return strconv.FormatInt(postByTitle(t, s, title).FeverID, 10)
+}
+
+func feverItemTitles(items []feverItem) []string {
+	titles := []string{}
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	return titles
+}
+
+// Returns the Fever IDs of the posts, sorted and joined like Fever ID lists
+func feverIDList(t *testing.T, s *state, titles ...string) string {
+	t.Helper()
+	ids := []int64{}
+	for _, title := range titles {
+		ids = append(ids, postByTitle(t, s, title).FeverID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return joinIDs(ids)
+}
+
+// Checks that the comma-separated ID list holds the IDs of the posts
+func assertFeverIDs(t *testing.T, s *state, got *string, titles ...string) {
+	t.Helper()
+	if got == nil {
+		t.Fatal("Response has no ID list")
+	}
+	ids := strings.Split(*got, ",")
+	sort.Slice(ids, func(i, j int) bool {
+		a, _ := strconv.ParseInt(ids[i], 10, 64)
+		b, _ := strconv.ParseInt(ids[j], 10, 64)
+		return a < b
+	})
+	if want := feverIDList(t, s, titles...); strings.Join(ids, ",") != want {
+		t.Errorf("Got IDs %q, want %q", *got, want)
+	}
+}
+
+func TestFeverAuthentication(t *testing.T) {
+	s, _, apiKey, h := newFeverTest(t)
+
+	if resp := feverCall(t, h, apiKey, "", nil); resp.Auth != 1 || resp.LastRefreshedOnTime == 0 {
+		t.Errorf("Valid key returned auth %d, last_refreshed_on_time %d", resp.Auth, resp.LastRefreshedOnTime)
+	}
+	// Clients may send the hash in upper case
+	if resp := feverCall(t, h, strings.ToUpper(apiKey), "", nil); resp.Auth != 1 {
+		t.Errorf("Upper case key returned auth %d", resp.Auth)
+	}
+	keys := listAPIKeys(t, s)
+	for _, wrong := range []string{feverAPIKey("bob", "gator_wrong"), keys[0].Prefix, ""} {
+		if resp := feverCall(t, h, wrong, "feeds", nil); resp.Auth != 0 || resp.Feeds != nil {
+			t.Errorf("Invalid key %q returned %+v", wrong, resp)
+		}
+	}
+
+	mustRun(t, s, "apikey", "revoke", keys[0].ID.String())
+	if resp := feverCall(t, h, apiKey, "", nil); resp.Auth != 0 {
+		t.Errorf("Revoked key returned auth %d", resp.Auth)
+	}
+}
+
+func TestFeverGroupsAndFeeds(t *testing.T) {
+	s, srv, apiKey, h := newFeverTest(t)
+	mustRun(t, s, "addfeed", "News", srv.URL+"/news.xml")
+	fetchFeeds(t, s)
+	blog, _ := s.db.GetFeedByUrl(context.Background(), srv.URL+"/rss.xml")
+	news, _ := s.db.GetFeedByUrl(context.Background(), srv.URL+"/news.xml")
+	feedIDs := joinIDs([]int64{min(blog.FeverID, news.FeverID), max(blog.FeverID, news.FeverID)})
+
+	resp := feverCall(t, h, apiKey, "groups", nil)
+	if len(resp.Groups) != 1 || resp.Groups[0].ID != feverGroupID || resp.Groups[0].Title != "All" {
+		t.Errorf("Unexpected groups %+v", resp.Groups)
+	}
+	if len(resp.FeedsGroups) != 1 || resp.FeedsGroups[0].GroupID != feverGroupID || resp.FeedsGroups[0].FeedIDs != feedIDs {
+		t.Errorf("Got feeds_groups %+v, want feeds %s", resp.FeedsGroups, feedIDs)
+	}
+
+	resp = feverCall(t, h, apiKey, "feeds", nil)
+	if len(resp.Feeds) != 2 || resp.FeedsGroups == nil {
+		t.Fatalf("Unexpected feeds %+v", resp.Feeds)
+	}
+	for _, feed := range resp.Feeds {
+		want := blog
+		if feed.Title == "News" {
+			want = news
+		}
+		if feed.ID != want.FeverID || feed.URL != want.Url || feed.LastUpdatedOnTime == 0 {
+			t.Errorf("Unexpected feed %+v", feed)
+		}
+	}
+
+	resp = feverCall(t, h, apiKey, "favicons&links", nil)
+	if resp.Favicons == nil || len(resp.Favicons) != 0 || resp.Links == nil || len(resp.Links) != 0 {
+		t.Errorf("Got favicons %v and links %v, want empty lists", resp.Favicons, resp.Links)
+	}
+	if resp.Groups != nil || resp.Feeds != nil || resp.Items != nil {
+		t.Errorf("Response has lists that were not requested: %+v", resp)
+	}
+
+	// Feeds of other users are not listed
+	mustRun(t, s, "register", "bob")
+	bobKey := feverAPIKey("bob", createAPIKey(t, s, "bob"))
+	resp = feverCall(t, h, bobKey, "groups&feeds", nil)
+	if len(resp.Feeds) != 0 || resp.FeedsGroups[0].FeedIDs != "" {
+		t.Errorf("bob got feeds %+v and feeds_groups %+v", resp.Feeds, resp.FeedsGroups)
+	}
+}
+
+func TestFeverItems(t *testing.T) {
+	s, _, apiKey, h := newFeverTest(t)
+	fuzzing := postByTitle(t, s, "Fuzzing")
+	mustRun(t, s, "read", fuzzing.ID.String())
+	mustRun(t, s, "star", fuzzing.ID.String())
+
+	resp := feverCall(t, h, apiKey, "items", nil)
+	if resp.TotalItems != 3 || len(resp.Items) != 3 {
+		t.Fatalf("Got %d of %d items, want 3", len(resp.Items), resp.TotalItems)
+	}
+	for i, item := range resp.Items {
+		if i > 0 && item.ID <= resp.Items[i-1].ID {
+			t.Errorf("Items are not in ascending order: %q", feverItemTitles(resp.Items))
+		}
+		post := postByTitle(t, s, item.Title)
+		if item.ID != post.FeverID || item.URL != post.Url || time.Unix(item.CreatedOnTime, 0).Year() != 2023 || item.FeedID == 0 {
+			t.Errorf("Item %+v does not match post %+v", item, post)
+		}
+		isFuzzing := feverBool(item.Title == "Fuzzing")
+		if item.IsRead != isFuzzing || item.IsSaved != isFuzzing {
+			t.Errorf("Item %q has is_read %d and is_saved %d", item.Title, item.IsRead, item.IsSaved)
+		}
+	}
+	all := feverItemTitles(resp.Items)
+	first, last := resp.Items[0], resp.Items[2]
+
+	resp = feverCall(t, h, apiKey, "items&since_id="+strconv.FormatInt(first.ID, 10), nil)
+	assertTitles(t, feverItemTitles(resp.Items), all[1], all[2])
+	if resp.TotalItems != 3 {
+		t.Errorf("Got total_items %d after since_id, want 3", resp.TotalItems)
+	}
+	resp = feverCall(t, h, apiKey, "items&max_id="+strconv.FormatInt(last.ID, 10), nil)
+	assertTitles(t, feverItemTitles(resp.Items), all[1], all[0])
+	resp = feverCall(t, h, apiKey, "items&with_ids="+feverID(t, s, "Generics in Go")+",%20"+feverID(t, s, "Fuzzing"), nil)
+	titles := feverItemTitles(resp.Items)
+	sort.Strings(titles)
+	assertTitles(t, titles, "Fuzzing", "Generics in Go")
+
+	resp = feverCall(t, h, apiKey, "unread_item_ids&saved_item_ids", nil)
+	assertFeverIDs(t, s, resp.UnreadItemIDs, "Generics in Go", "Error handling")
+	assertFeverIDs(t, s, resp.SavedItemIDs, "Fuzzing")
+
+	for _, query := range []string{"items&since_id=x", "items&max_id=1.5", "items&with_ids=1,x"} {
+		if rec := feverRequest(t, h, apiKey, query, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("Fever request %q returned %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestFeverMarkItems(t *testing.T) {
+	s, srv, apiKey, h := newFeverTest(t)
+	id := feverID(t, s, "Fuzzing")
+	mark := func(as string) feverResponse {
+		return feverCall(t, h, apiKey, "", url.Values{"mark": {"item"}, "as": {as}, "id": {id}})
+	}
+
+	// The changed list is returned after marking
+	assertFeverIDs(t, s, mark("read").UnreadItemIDs, "Generics in Go", "Error handling")
+	assertTitles(t, browseTitles(t, s, "10"), "Error handling", "Generics in Go")
+	assertFeverIDs(t, s, mark("unread").UnreadItemIDs, "Generics in Go", "Error handling", "Fuzzing")
+	assertFeverIDs(t, s, mark("saved").SavedItemIDs, "Fuzzing")
+	assertContains(t, mustRun(t, s, "starred"), "Title: Fuzzing")
+	if resp := mark("unsaved"); resp.SavedItemIDs == nil || *resp.SavedItemIDs != "" {
+		t.Errorf("Got saved_item_ids %v after unsaving", resp.SavedItemIDs)
+	}
+
+	// Unknown items and items of feeds the user does not follow are ignored
+	feverCall(t, h, apiKey, "", url.Values{"mark": {"item"}, "as": {"read"}, "id": {"999999"}})
+	mustRun(t, s, "register", "bob")
+	bobKey := feverAPIKey("bob", createAPIKey(t, s, "bob"))
+	for _, as := range []string{"read", "saved"} {
+		feverCall(t, h, bobKey, "", url.Values{"mark": {"item"}, "as": {as}, "id": {id}})
+	}
+	mustRun(t, s, "follow", srv.URL+"/rss.xml")
+	resp := feverCall(t, h, bobKey, "unread_item_ids&saved_item_ids", nil)
+	assertFeverIDs(t, s, resp.UnreadItemIDs, "Generics in Go", "Error handling", "Fuzzing")
+	if *resp.SavedItemIDs != "" {
+		t.Errorf("bob saved items %q before following their feed", *resp.SavedItemIDs)
+	}
+
+	for _, form := range []url.Values{
+		{"mark": {"item"}, "as": {"starred"}, "id": {id}},
+		{"mark": {"item"}, "as": {"read"}, "id": {"x"}},
+		{"mark": {"item"}, "as": {"read"}},
+		{"mark": {"feed"}, "as": {"unread"}, "id": {"1"}},
+		{"mark": {"post"}, "as": {"read"}, "id": {id}},
+	} {
+		if rec := feverRequest(t, h, apiKey, "", form); rec.Code != http.StatusBadRequest {
+			t.Errorf("Marking %v returned %d, want 400", form, rec.Code)
+		}
+	}
+}
+
+func TestFeverMarkFeedsAndGroups(t *testing.T) {
+	s, srv, apiKey, h := newFeverTest(t)
+	mustRun(t, s, "addfeed", "News", srv.URL+"/news.xml")
+	fetchFeeds(t, s)
+	blog, err := s.db.GetFeedByUrl(context.Background(), srv.URL+"/rss.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	markFeed := func(mark string, id int64, before time.Time) {
+		t.Helper()
+		feverCall(t, h, apiKey, "", url.Values{
+			"mark":   {mark},
+			"as":     {"read"},
+			"id":     {strconv.FormatInt(id, 10)},
+			"before": {strconv.FormatInt(before.Unix(), 10)},
+		})
+	}
+
+	// Only posts fetched before the given time are marked
+	markFeed("feed", blog.FeverID, time.Now().Add(-time.Hour))
+	assertTitles(t, browseTitles(t, s, "10"), "Release notes", "Fuzzing", "Error handling", "Generics in Go")
+	markFeed("feed", blog.FeverID, time.Now().Add(time.Hour))
+	assertTitles(t, browseTitles(t, s, "10"), "Release notes")
+
+	// Sparks and unknown feeds are ignored
+	markFeed("group", -1, time.Now().Add(time.Hour))
+	markFeed("feed", 999999, time.Now().Add(time.Hour))
+	assertTitles(t, browseTitles(t, s, "10"), "Release notes")
+
+	// Group 0 holds all feeds
+	markFeed("group", 0, time.Now().Add(time.Hour))
+	assertTitles(t, browseTitles(t, s, "10"))
+
+	// Marking the group does not change the posts of other users
+	mustRun(t, s, "register", "bob")
+	mustRun(t, s, "follow", srv.URL+"/news.xml")
+	assertTitles(t, browseTitles(t, s, "10"), "Release notes")
+}
@@ -12,6 +12,8 @@ const configFileName = ".gatorconfig.json"
 type Config struct {
 	DbURL string `json:"db_url"`
 	CurrentUsername string `json:"current_user_name"`
+	// Consecutive fetch failures after which agg disables a feed
+	MaxFeedFailures int `json:"max_feed_failures,omitempty"`
 }
 
 // Read a JSON config file and return Config struct
@@ -7,11 +7,78 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const claimNextFeedsToFetch = `-- name: ClaimNextFeedsToFetch :many
+UPDATE feeds
+SET claimed_until = NOW() + $1::int * INTERVAL '1 second'
+WHERE feeds.id IN (
+  SELECT id FROM feeds
+  WHERE NOT disabled
+  AND (retry_after IS NULL OR retry_after <= NOW())
+  AND (claimed_until IS NULL OR claimed_until < NOW())
+  AND (last_fetched_at IS NULL OR last_fetched_at < $2::timestamptz)
+  ORDER BY last_fetched_at NULLS FIRST
+  LIMIT $3
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, claimed_until, last_error, consecutive_failures, last_success_at, last_http_status, retry_after, disabled, fever_id
+`
+
+type ClaimNextFeedsToFetchParams struct {
+	LeaseSeconds  int32
+	FetchedBefore time.Time
+	BatchSize     int32
+}
+
+// Leases the least recently fetched feeds that are not claimed by another
+// worker and were not fetched since fetched_before. Expired leases from
+// crashed workers can be claimed again.
+func (q *Queries) ClaimNextFeedsToFetch(ctx context.Context, arg ClaimNextFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimNextFeedsToFetch, arg.LeaseSeconds, arg.FetchedBefore, arg.BatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ClaimedUntil,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastSuccessAt,
+			&i.LastHttpStatus,
+			&i.RetryAfter,
+			&i.Disabled,
+			&i.FeverID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createFeed = `-- name: CreateFeed :one
 INSERT INTO feeds (id, created_at, updated_at, name, url, user_id) VALUES(
   $1,
@@ -21,7 +88,7 @@ INSERT INTO feeds (id, created_at, updated_at, name, url, user_id) VALUES(
   $5,
   $6
 )
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, claimed_until, last_error, consecutive_failures, last_success_at, last_http_status, retry_after, disabled, fever_id
 `
 
 type CreateFeedParams struct {
@@ -51,12 +118,63 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.LastHttpStatus,
+		&i.RetryAfter,
+		&i.Disabled,
+		&i.FeverID,
+	)
+	return i, err
+}
+
+const enableFeed = `-- name: EnableFeed :exec
+UPDATE feeds
+SET disabled = FALSE, consecutive_failures = 0, retry_after = NULL, updated_at = NOW()
+WHERE feeds.id = $1
+`
+
+func (q *Queries) EnableFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, enableFeed, id)
+	return err
+}
+
+const getFeedByFeverID = `-- name: GetFeedByFeverID :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, claimed_until, last_error, consecutive_failures, last_success_at, last_http_status, retry_after, disabled, fever_id FROM feeds
+WHERE fever_id = $1
+`
+
+func (q *Queries) GetFeedByFeverID(ctx context.Context, feverID int64) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByFeverID, feverID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.LastHttpStatus,
+		&i.RetryAfter,
+		&i.Disabled,
+		&i.FeverID,
 	)
 	return i, err
 }
 
 const getFeedByUrl = `-- name: GetFeedByUrl :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, claimed_until, last_error, consecutive_failures, last_success_at, last_http_status, retry_after, disabled, fever_id FROM feeds
 WHERE url = $1
 `
 
@@ -71,21 +189,42 @@ func (q *Queries) GetFeedByUrl(ctx context.Context, url string) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.LastHttpStatus,
+		&i.RetryAfter,
+		&i.Disabled,
+		&i.FeverID,
 	)
 	return i, err
 }
 
 const getFeedsWithCreators = `-- name: GetFeedsWithCreators :many
-SELECT feeds.name, feeds.url, users.name AS user_name
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.last_fetched_at,
+  feeds.consecutive_failures, feeds.last_error, feeds.last_success_at,
+  feeds.last_http_status, feeds.disabled, users.name AS user_name
 FROM feeds
 INNER JOIN users
 ON users.id = feeds.user_id
 `
 
 type GetFeedsWithCreatorsRow struct {
-	Name     string
-	Url      string
-	UserName string
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	LastFetchedAt       sql.NullTime
+	ConsecutiveFailures int32
+	LastError           sql.NullString
+	LastSuccessAt       sql.NullTime
+	LastHttpStatus      sql.NullInt32
+	Disabled            bool
+	UserName            string
 }
 
 func (q *Queries) GetFeedsWithCreators(ctx context.Context) ([]GetFeedsWithCreatorsRow, error) {
@@ -97,7 +236,69 @@ func (q *Queries) GetFeedsWithCreators(ctx context.Context) ([]GetFeedsWithCreat
 	var items []GetFeedsWithCreatorsRow
 	for rows.Next() {
 		var i GetFeedsWithCreatorsRow
-		if err := rows.Scan(&i.Name, &i.Url, &i.UserName); err != nil {
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.LastFetchedAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastSuccessAt,
+			&i.LastHttpStatus,
+			&i.Disabled,
+			&i.UserName,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFollowedFeeds = `-- name: GetFollowedFeeds :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.etag, feeds.last_modified, feeds.claimed_until, feeds.last_error, feeds.consecutive_failures, feeds.last_success_at, feeds.last_http_status, feeds.retry_after, feeds.disabled, feeds.fever_id FROM feeds
+INNER JOIN feed_follows
+ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1
+ORDER BY feeds.fever_id
+`
+
+func (q *Queries) GetFollowedFeeds(ctx context.Context, userID uuid.UUID) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedFeeds, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.ClaimedUntil,
+			&i.LastError,
+			&i.ConsecutiveFailures,
+			&i.LastSuccessAt,
+			&i.LastHttpStatus,
+			&i.RetryAfter,
+			&i.Disabled,
+			&i.FeverID,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -111,14 +312,47 @@ func (q *Queries) GetFeedsWithCreators(ctx context.Context) ([]GetFeedsWithCreat
 	return items, nil
 }
 
-const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at NULLS FIRST
-LIMIT 1
+const markFeedFetched = `-- name: MarkFeedFetched :exec
+UPDATE feeds
+SET last_fetched_at = NOW(), updated_at = NOW()
+WHERE feeds.id = $1
+`
+
+func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, markFeedFetched, id)
+	return err
+}
+
+const recordFeedFailure = `-- name: RecordFeedFailure :one
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1,
+  last_error = $1,
+  last_http_status = $2,
+  retry_after = NOW() + $3::int * INTERVAL '1 second',
+  disabled = consecutive_failures + 1 >= $4::int,
+  updated_at = NOW()
+WHERE feeds.id = $5
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, claimed_until, last_error, consecutive_failures, last_success_at, last_http_status, retry_after, disabled, fever_id
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+type RecordFeedFailureParams struct {
+	LastError      sql.NullString
+	LastHttpStatus sql.NullInt32
+	BackoffSeconds int32
+	MaxFailures    int32
+	ID             uuid.UUID
+}
+
+// Backs the feed off until retry_after and disables it once the number of
+// consecutive failures reaches max_failures.
+func (q *Queries) RecordFeedFailure(ctx context.Context, arg RecordFeedFailureParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, recordFeedFailure,
+		arg.LastError,
+		arg.LastHttpStatus,
+		arg.BackoffSeconds,
+		arg.MaxFailures,
+		arg.ID,
+	)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -128,17 +362,61 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.ClaimedUntil,
+		&i.LastError,
+		&i.ConsecutiveFailures,
+		&i.LastSuccessAt,
+		&i.LastHttpStatus,
+		&i.RetryAfter,
+		&i.Disabled,
+		&i.FeverID,
 	)
 	return i, err
 }
 
-const markFeedFetched = `-- name: MarkFeedFetched :exec
+const recordFeedSuccess = `-- name: RecordFeedSuccess :exec
 UPDATE feeds
-SET last_fetched_at = NOW(), updated_at = NOW()
+SET consecutive_failures = 0, last_error = NULL, last_http_status = $2,
+  last_success_at = NOW(), retry_after = NULL, updated_at = NOW()
 WHERE feeds.id = $1
 `
 
-func (q *Queries) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, markFeedFetched, id)
+type RecordFeedSuccessParams struct {
+	ID             uuid.UUID
+	LastHttpStatus sql.NullInt32
+}
+
+func (q *Queries) RecordFeedSuccess(ctx context.Context, arg RecordFeedSuccessParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedSuccess, arg.ID, arg.LastHttpStatus)
+	return err
+}
+
+const releaseFeedClaim = `-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET claimed_until = NULL
+WHERE feeds.id = $1
+`
+
+func (q *Queries) ReleaseFeedClaim(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedClaim, id)
+	return err
+}
+
+const setFeedCacheValidators = `-- name: SetFeedCacheValidators :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3, updated_at = NOW()
+WHERE feeds.id = $1
+`
+
+type SetFeedCacheValidatorsParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+func (q *Queries) SetFeedCacheValidators(ctx context.Context, arg SetFeedCacheValidatorsParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedCacheValidators, arg.ID, arg.Etag, arg.LastModified)
 	return err
 }
@@ -0,0 +1,990 @@
+// Package memory keeps gator's data in memory, for testing the command and
+// API handlers without a database server.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhiillos/gator/internal/database"
+)
+
+// Store implements the queries of the database package on in-memory tables,
+// following the constraints of the SQL schema: unique names and URLs,
+// foreign keys and cascading deletes.
+type Store struct {
+	mu        sync.Mutex
+	users     map[uuid.UUID]database.User
+	feeds     map[uuid.UUID]database.Feed
+	follows   map[uuid.UUID]database.FeedFollow
+	posts     map[uuid.UUID]database.Post
+	revisions map[uuid.UUID]database.PostRevision
+	states    map[stateKey]database.PostState
+	apiKeys   map[uuid.UUID]database.ApiKey
+	// The last fever_id given to a feed and to a post
+	feedSeq int64
+	postSeq int64
+}
+
+type stateKey struct {
+	userID uuid.UUID
+	postID uuid.UUID
+}
+
+var _ database.Querier = (*Store)(nil)
+
+// Returns an empty store
+func New() *Store {
+	return &Store{
+		users:     make(map[uuid.UUID]database.User),
+		feeds:     make(map[uuid.UUID]database.Feed),
+		follows:   make(map[uuid.UUID]database.FeedFollow),
+		posts:     make(map[uuid.UUID]database.Post),
+		revisions: make(map[uuid.UUID]database.PostRevision),
+		states:    make(map[stateKey]database.PostState),
+		apiKeys:   make(map[uuid.UUID]database.ApiKey),
+	}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: true}
+}
+
+// Reports whether a sorts before b, ordering by published_at and then id
+func postBefore(a, b database.Post) bool {
+	if !a.PublishedAt.Equal(b.PublishedAt) {
+		return a.PublishedAt.Before(b.PublishedAt)
+	}
+	return bytes.Compare(a.ID[:], b.ID[:]) < 0
+}
+
+// Returns the ids of the feeds the user follows
+func (s *Store) followedFeeds(userID uuid.UUID) map[uuid.UUID]bool {
+	feedIDs := make(map[uuid.UUID]bool)
+	for _, follow := range s.follows {
+		if follow.UserID == userID {
+			feedIDs[follow.FeedID] = true
+		}
+	}
+	return feedIDs
+}
+
+func (s *Store) deletePost(id uuid.UUID) {
+	delete(s.posts, id)
+	for revisionID, revision := range s.revisions {
+		if revision.PostID == id {
+			delete(s.revisions, revisionID)
+		}
+	}
+	for key := range s.states {
+		if key.postID == id {
+			delete(s.states, key)
+		}
+	}
+}
+
+func (s *Store) deleteFeed(id uuid.UUID) {
+	delete(s.feeds, id)
+	for followID, follow := range s.follows {
+		if follow.FeedID == id {
+			delete(s.follows, followID)
+		}
+	}
+	for postID, post := range s.posts {
+		if post.FeedID == id {
+			s.deletePost(postID)
+		}
+	}
+}
+
+func (s *Store) AdoptPostGuid(ctx context.Context, arg database.AdoptPostGuidParams) (database.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, post := range s.posts {
+		if post.FeedID == arg.FeedID && post.Url == arg.Url && post.Guid == post.Url {
+			post.Guid = arg.Guid
+			s.posts[id] = post
+			return post, nil
+		}
+	}
+	return database.Post{}, sql.ErrNoRows
+}
+
+func (s *Store) ClaimNextFeedsToFetch(ctx context.Context, arg database.ClaimNextFeedsToFetchParams) ([]database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	due := []database.Feed{}
+	for _, feed := range s.feeds {
+		if feed.Disabled {
+			continue
+		}
+		if feed.RetryAfter.Valid && feed.RetryAfter.Time.After(now) {
+			continue
+		}
+		if feed.ClaimedUntil.Valid && !feed.ClaimedUntil.Time.Before(now) {
+			continue
+		}
+		if feed.LastFetchedAt.Valid && !feed.LastFetchedAt.Time.Before(arg.FetchedBefore) {
+			continue
+		}
+		due = append(due, feed)
+	}
+	sort.Slice(due, func(i, j int) bool {
+		a, b := due[i].LastFetchedAt, due[j].LastFetchedAt
+		if !a.Valid || !b.Valid {
+			return !a.Valid && b.Valid
+		}
+		return a.Time.Before(b.Time)
+	})
+	if len(due) > int(arg.BatchSize) {
+		due = due[:arg.BatchSize]
+	}
+	for i := range due {
+		due[i].ClaimedUntil = nullTime(now.Add(time.Duration(arg.LeaseSeconds) * time.Second))
+		s.feeds[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (s *Store) CountPostsForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	followed := s.followedFeeds(userID)
+	count := int64(0)
+	for _, post := range s.posts {
+		if followed[post.FeedID] {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) CreateAPIKey(ctx context.Context, arg database.CreateAPIKeyParams) (database.ApiKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[arg.UserID]; !ok {
+		return database.ApiKey{}, fmt.Errorf("User %s does not exist", arg.UserID)
+	}
+	for _, key := range s.apiKeys {
+		if key.KeyHash == arg.KeyHash || arg.FeverKeyHash.Valid && key.FeverKeyHash == arg.FeverKeyHash {
+			return database.ApiKey{}, fmt.Errorf("API key with hash %q already exists", arg.KeyHash)
+		}
+	}
+	key := database.ApiKey{
+		ID:           arg.ID,
+		CreatedAt:    arg.CreatedAt,
+		UserID:       arg.UserID,
+		Name:         arg.Name,
+		KeyHash:      arg.KeyHash,
+		Prefix:       arg.Prefix,
+		FeverKeyHash: arg.FeverKeyHash,
+	}
+	s.apiKeys[key.ID] = key
+	return key, nil
+}
+
+func (s *Store) CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[arg.UserID]; !ok {
+		return database.Feed{}, fmt.Errorf("User %s does not exist", arg.UserID)
+	}
+	for _, feed := range s.feeds {
+		if feed.Url == arg.Url {
+			return database.Feed{}, fmt.Errorf("Feed with URL %q already exists", arg.Url)
+		}
+	}
+	feed := database.Feed{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		Name:      arg.Name,
+		Url:       arg.Url,
+		UserID:    arg.UserID,
+	}
+	s.feedSeq++
+	feed.FeverID = s.feedSeq
+	s.feeds[feed.ID] = feed
+	return feed, nil
+}
+
+func (s *Store) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[arg.UserID]
+	if !ok {
+		return database.CreateFeedFollowRow{}, fmt.Errorf("User %s does not exist", arg.UserID)
+	}
+	feed, ok := s.feeds[arg.FeedID]
+	if !ok {
+		return database.CreateFeedFollowRow{}, fmt.Errorf("Feed %s does not exist", arg.FeedID)
+	}
+	s.follows[arg.ID] = database.FeedFollow(arg)
+	return database.CreateFeedFollowRow{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		UserID:    arg.UserID,
+		FeedID:    arg.FeedID,
+		UserName:  user.Name,
+		FeedName:  feed.Name,
+	}, nil
+}
+
+// Returns sql.ErrNoRows if the feed already has a post with the same guid
+func (s *Store) CreatePost(ctx context.Context, arg database.CreatePostParams) (database.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.feeds[arg.FeedID]; !ok {
+		return database.Post{}, fmt.Errorf("Feed %s does not exist", arg.FeedID)
+	}
+	for _, post := range s.posts {
+		if post.FeedID == arg.FeedID && post.Guid == arg.Guid {
+			return database.Post{}, sql.ErrNoRows
+		}
+	}
+	post := database.Post{
+		ID:          arg.ID,
+		CreatedAt:   arg.CreatedAt,
+		UpdatedAt:   arg.UpdatedAt,
+		Title:       arg.Title,
+		Url:         arg.Url,
+		Description: arg.Description,
+		PublishedAt: arg.PublishedAt,
+		FeedID:      arg.FeedID,
+		Guid:        arg.Guid,
+		ContentHash: arg.ContentHash,
+	}
+	s.postSeq++
+	post.FeverID = s.postSeq
+	s.posts[post.ID] = post
+	return post, nil
+}
+
+func (s *Store) CreatePostRevision(ctx context.Context, arg database.CreatePostRevisionParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.posts[arg.PostID]; !ok {
+		return fmt.Errorf("Post %s does not exist", arg.PostID)
+	}
+	s.revisions[arg.ID] = database.PostRevision(arg)
+	return nil
+}
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Name == arg.Name {
+			return database.User{}, fmt.Errorf("User %q already exists", arg.Name)
+		}
+	}
+	user := database.User(arg)
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *Store) DeleteFeedFollow(ctx context.Context, arg database.DeleteFeedFollowParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, follow := range s.follows {
+		if follow.UserID == arg.UserID && follow.FeedID == arg.FeedID {
+			delete(s.follows, id)
+		}
+	}
+	return nil
+}
+
+func (s *Store) EnableFeed(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[id]
+	if !ok {
+		return nil
+	}
+	feed.Disabled = false
+	feed.ConsecutiveFailures = 0
+	feed.RetryAfter = sql.NullTime{}
+	feed.UpdatedAt = time.Now()
+	s.feeds[id] = feed
+	return nil
+}
+
+func (s *Store) GetAPIKeysForUser(ctx context.Context, userID uuid.UUID) ([]database.ApiKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := []database.ApiKey{}
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (s *Store) GetFeedByFeverID(ctx context.Context, feverID int64) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, feed := range s.feeds {
+		if feed.FeverID == feverID {
+			return feed, nil
+		}
+	}
+	return database.Feed{}, sql.ErrNoRows
+}
+
+func (s *Store) GetFeedByUrl(ctx context.Context, url string) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, feed := range s.feeds {
+		if feed.Url == url {
+			return feed, nil
+		}
+	}
+	return database.Feed{}, sql.ErrNoRows
+}
+
+func (s *Store) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeedFollowsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []database.GetFeedFollowsForUserRow{}
+	for _, follow := range s.follows {
+		if follow.UserID != userID {
+			continue
+		}
+		feed := s.feeds[follow.FeedID]
+		rows = append(rows, database.GetFeedFollowsForUserRow{
+			ID:        follow.ID,
+			CreatedAt: follow.CreatedAt,
+			UpdatedAt: follow.UpdatedAt,
+			UserID:    follow.UserID,
+			FeedID:    follow.FeedID,
+			UserName:  s.users[follow.UserID].Name,
+			FeedName:  feed.Name,
+			FeedUrl:   feed.Url,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].FeedName < rows[j].FeedName
+	})
+	return rows, nil
+}
+
+func (s *Store) GetFeedsWithCreators(ctx context.Context) ([]database.GetFeedsWithCreatorsRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []database.GetFeedsWithCreatorsRow{}
+	for _, feed := range s.feeds {
+		rows = append(rows, database.GetFeedsWithCreatorsRow{
+			ID:                  feed.ID,
+			CreatedAt:           feed.CreatedAt,
+			UpdatedAt:           feed.UpdatedAt,
+			Name:                feed.Name,
+			Url:                 feed.Url,
+			LastFetchedAt:       feed.LastFetchedAt,
+			ConsecutiveFailures: feed.ConsecutiveFailures,
+			LastError:           feed.LastError,
+			LastSuccessAt:       feed.LastSuccessAt,
+			LastHttpStatus:      feed.LastHttpStatus,
+			Disabled:            feed.Disabled,
+			UserName:            s.users[feed.UserID].Name,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].CreatedAt.Before(rows[j].CreatedAt)
+	})
+	return rows, nil
+}
+
+func (s *Store) GetFeverItemsForUser(ctx context.Context, arg database.GetFeverItemsForUserParams) ([]database.GetFeverItemsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	followed := s.followedFeeds(arg.UserID)
+	withIDs := make(map[int64]bool)
+	for _, id := range arg.WithIds {
+		withIDs[id] = true
+	}
+	rows := []database.GetFeverItemsForUserRow{}
+	for _, post := range s.posts {
+		if !followed[post.FeedID] {
+			continue
+		}
+		if arg.SinceID.Valid && post.FeverID <= arg.SinceID.Int64 {
+			continue
+		}
+		if arg.MaxID.Valid && post.FeverID >= arg.MaxID.Int64 {
+			continue
+		}
+		if arg.WithIds != nil && !withIDs[post.FeverID] {
+			continue
+		}
+		state := s.states[stateKey{arg.UserID, post.ID}]
+		rows = append(rows, database.GetFeverItemsForUserRow{
+			ID:          post.ID,
+			CreatedAt:   post.CreatedAt,
+			UpdatedAt:   post.UpdatedAt,
+			Title:       post.Title,
+			Url:         post.Url,
+			Description: post.Description,
+			PublishedAt: post.PublishedAt,
+			FeedID:      post.FeedID,
+			Guid:        post.Guid,
+			ContentHash: post.ContentHash,
+			FeverID:     post.FeverID,
+			FeedFeverID: s.feeds[post.FeedID].FeverID,
+			Read:        state.Read,
+			Starred:     state.Starred,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if arg.MaxID.Valid {
+			return rows[i].FeverID > rows[j].FeverID
+		}
+		return rows[i].FeverID < rows[j].FeverID
+	})
+	return rows[:min(int(arg.Limit), len(rows))], nil
+}
+
+func (s *Store) GetFollowedFeeds(ctx context.Context, userID uuid.UUID) ([]database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feeds := []database.Feed{}
+	for id := range s.followedFeeds(userID) {
+		feeds = append(feeds, s.feeds[id])
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].FeverID < feeds[j].FeverID
+	})
+	return feeds, nil
+}
+
+func (s *Store) GetPost(ctx context.Context, id uuid.UUID) (database.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post, ok := s.posts[id]
+	if !ok {
+		return database.Post{}, sql.ErrNoRows
+	}
+	return post, nil
+}
+
+func (s *Store) GetPostByFeverID(ctx context.Context, feverID int64) (database.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, post := range s.posts {
+		if post.FeverID == feverID {
+			return post, nil
+		}
+	}
+	return database.Post{}, sql.ErrNoRows
+}
+
+func (s *Store) GetPostByGuid(ctx context.Context, arg database.GetPostByGuidParams) (database.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, post := range s.posts {
+		if post.FeedID == arg.FeedID && post.Guid == arg.Guid {
+			return post, nil
+		}
+	}
+	return database.Post{}, sql.ErrNoRows
+}
+
+func (s *Store) GetPostForUser(ctx context.Context, arg database.GetPostForUserParams) (database.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post, ok := s.posts[arg.ID]
+	if !ok || !s.followedFeeds(arg.UserID)[post.FeedID] {
+		return database.Post{}, sql.ErrNoRows
+	}
+	return post, nil
+}
+
+func (s *Store) GetPostsForUser(ctx context.Context, arg database.GetPostsForUserParams) ([]database.GetPostsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	followed := s.followedFeeds(arg.UserID)
+	posts := []database.Post{}
+	for _, post := range s.posts {
+		if !followed[post.FeedID] {
+			continue
+		}
+		if arg.UnreadOnly && s.states[stateKey{arg.UserID, post.ID}].Read {
+			continue
+		}
+		feed := s.feeds[post.FeedID]
+		if arg.Feed.Valid && feed.Url != arg.Feed.String && feed.Name != arg.Feed.String {
+			continue
+		}
+		if arg.Since.Valid && post.PublishedAt.Before(arg.Since.Time) {
+			continue
+		}
+		if arg.Until.Valid && !post.PublishedAt.Before(arg.Until.Time) {
+			continue
+		}
+		if arg.AfterPublishedAt.Valid {
+			after := database.Post{PublishedAt: arg.AfterPublishedAt.Time, ID: arg.AfterID.UUID}
+			if arg.SortAsc && !postBefore(after, post) || !arg.SortAsc && !postBefore(post, after) {
+				continue
+			}
+		}
+		posts = append(posts, post)
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if arg.SortAsc {
+			return postBefore(posts[i], posts[j])
+		}
+		return postBefore(posts[j], posts[i])
+	})
+	posts = posts[min(int(arg.Offset), len(posts)):]
+	posts = posts[:min(int(arg.Limit), len(posts))]
+
+	rows := []database.GetPostsForUserRow{}
+	for _, post := range posts {
+		revisions := int64(0)
+		for _, revision := range s.revisions {
+			if revision.PostID == post.ID {
+				revisions++
+			}
+		}
+		state := s.states[stateKey{arg.UserID, post.ID}]
+		rows = append(rows, database.GetPostsForUserRow{
+			ID:          post.ID,
+			CreatedAt:   post.CreatedAt,
+			UpdatedAt:   post.UpdatedAt,
+			Title:       post.Title,
+			Url:         post.Url,
+			Description: post.Description,
+			PublishedAt: post.PublishedAt,
+			FeedID:      post.FeedID,
+			Guid:        post.Guid,
+			ContentHash: post.ContentHash,
+			FeverID:     post.FeverID,
+			Revisions:   revisions,
+			Read:        state.Read,
+			Starred:     state.Starred,
+		})
+	}
+	return rows, nil
+}
+
+// Returns the fever_ids of the posts of followed feeds whose state matches
+func (s *Store) feverIDs(userID uuid.UUID, match func(state database.PostState) bool) []int64 {
+	followed := s.followedFeeds(userID)
+	ids := []int64{}
+	for _, post := range s.posts {
+		if followed[post.FeedID] && match(s.states[stateKey{userID, post.ID}]) {
+			ids = append(ids, post.FeverID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+func (s *Store) GetStarredFeverIDs(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.feverIDs(userID, func(state database.PostState) bool {
+		return state.Starred
+	}), nil
+}
+
+func (s *Store) GetStarredPostsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetStarredPostsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rows := []database.GetStarredPostsForUserRow{}
+	for key, state := range s.states {
+		if key.userID != userID || !state.Starred {
+			continue
+		}
+		post := s.posts[key.postID]
+		rows = append(rows, database.GetStarredPostsForUserRow{
+			ID:          post.ID,
+			CreatedAt:   post.CreatedAt,
+			UpdatedAt:   post.UpdatedAt,
+			Title:       post.Title,
+			Url:         post.Url,
+			Description: post.Description,
+			PublishedAt: post.PublishedAt,
+			FeedID:      post.FeedID,
+			Guid:        post.Guid,
+			ContentHash: post.ContentHash,
+			FeverID:     post.FeverID,
+			Read:        state.Read,
+			StarredAt:   state.StarredAt,
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].StarredAt.Time.After(rows[j].StarredAt.Time)
+	})
+	return rows, nil
+}
+
+func (s *Store) GetUnreadFeverIDs(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.feverIDs(userID, func(state database.PostState) bool {
+		return !state.Read
+	}), nil
+}
+
+func (s *Store) GetUser(ctx context.Context, name string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Name == name {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *Store) GetUserByAPIKey(ctx context.Context, keyHash string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.apiKeys {
+		if key.KeyHash == keyHash && !key.RevokedAt.Valid {
+			return s.users[key.UserID], nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *Store) GetUserByFeverKey(ctx context.Context, feverKeyHash string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.apiKeys {
+		if key.FeverKeyHash.Valid && key.FeverKeyHash.String == feverKeyHash && !key.RevokedAt.Valid {
+			return s.users[key.UserID], nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *Store) GetUsers(ctx context.Context) ([]database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := []database.User{}
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	return users, nil
+}
+
+// Sets the read or starred state of a post, creating the state if needed
+func (s *Store) updateState(userID, postID uuid.UUID, update func(state *database.PostState)) error {
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("User %s does not exist", userID)
+	}
+	if _, ok := s.posts[postID]; !ok {
+		return fmt.Errorf("Post %s does not exist", postID)
+	}
+	now := time.Now()
+	key := stateKey{userID, postID}
+	state, ok := s.states[key]
+	if !ok {
+		state = database.PostState{UserID: userID, PostID: postID, CreatedAt: now}
+	}
+	state.UpdatedAt = now
+	update(&state)
+	s.states[key] = state
+	return nil
+}
+
+func (s *Store) MarkAPIKeyUsed(ctx context.Context, keyHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, key := range s.apiKeys {
+		if key.KeyHash == keyHash {
+			key.LastUsedAt = nullTime(time.Now())
+			s.apiKeys[id] = key
+		}
+	}
+	return nil
+}
+
+func (s *Store) MarkAllPostsRead(ctx context.Context, arg database.MarkAllPostsReadParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	followed := s.followedFeeds(arg.UserID)
+	marked := int64(0)
+	for _, post := range s.posts {
+		if !followed[post.FeedID] || arg.FeedID.Valid && post.FeedID != arg.FeedID.UUID {
+			continue
+		}
+		if arg.Before.Valid && !post.CreatedAt.Before(arg.Before.Time) {
+			continue
+		}
+		if s.states[stateKey{arg.UserID, post.ID}].Read {
+			continue
+		}
+		err := s.updateState(arg.UserID, post.ID, func(state *database.PostState) {
+			state.Read = true
+			state.ReadAt = nullTime(state.UpdatedAt)
+		})
+		if err != nil {
+			return marked, err
+		}
+		marked++
+	}
+	return marked, nil
+}
+
+func (s *Store) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[id]
+	if !ok {
+		return nil
+	}
+	feed.LastFetchedAt = nullTime(time.Now())
+	feed.UpdatedAt = feed.LastFetchedAt.Time
+	s.feeds[id] = feed
+	return nil
+}
+
+func (s *Store) MarkPostRead(ctx context.Context, arg database.MarkPostReadParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateState(arg.UserID, arg.PostID, func(state *database.PostState) {
+		state.Read = true
+		state.ReadAt = nullTime(state.UpdatedAt)
+	})
+}
+
+func (s *Store) MarkPostUnread(ctx context.Context, arg database.MarkPostUnreadParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateState(arg.UserID, arg.PostID, func(state *database.PostState) {
+		state.Read = false
+		state.ReadAt = sql.NullTime{}
+	})
+}
+
+func (s *Store) RecordFeedFailure(ctx context.Context, arg database.RecordFeedFailureParams) (database.Feed, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok {
+		return database.Feed{}, sql.ErrNoRows
+	}
+	now := time.Now()
+	feed.ConsecutiveFailures++
+	feed.LastError = arg.LastError
+	feed.LastHttpStatus = arg.LastHttpStatus
+	feed.RetryAfter = nullTime(now.Add(time.Duration(arg.BackoffSeconds) * time.Second))
+	feed.Disabled = feed.ConsecutiveFailures >= arg.MaxFailures
+	feed.UpdatedAt = now
+	s.feeds[arg.ID] = feed
+	return feed, nil
+}
+
+func (s *Store) RecordFeedSuccess(ctx context.Context, arg database.RecordFeedSuccessParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	feed.ConsecutiveFailures = 0
+	feed.LastError = sql.NullString{}
+	feed.LastHttpStatus = arg.LastHttpStatus
+	feed.LastSuccessAt = nullTime(now)
+	feed.RetryAfter = sql.NullTime{}
+	feed.UpdatedAt = now
+	s.feeds[arg.ID] = feed
+	return nil
+}
+
+func (s *Store) ReleaseFeedClaim(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[id]
+	if !ok {
+		return nil
+	}
+	feed.ClaimedUntil = sql.NullTime{}
+	s.feeds[id] = feed
+	return nil
+}
+
+func (s *Store) ResetUsers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.feeds {
+		s.deleteFeed(id)
+	}
+	clear(s.users)
+	clear(s.follows)
+	clear(s.states)
+	clear(s.apiKeys)
+	return nil
+}
+
+func (s *Store) RevokeAPIKey(ctx context.Context, arg database.RevokeAPIKeyParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.apiKeys[arg.ID]
+	if !ok || key.UserID != arg.UserID || key.RevokedAt.Valid {
+		return 0, nil
+	}
+	key.RevokedAt = nullTime(time.Now())
+	s.apiKeys[arg.ID] = key
+	return 1, nil
+}
+
+// Matches posts containing all words of the query, ignoring case. Words
+// starting with "-" exclude posts, and "or" and quotes are ignored. Title
+// matches rank above description matches.
+func (s *Store) SearchPostsForUser(ctx context.Context, arg database.SearchPostsForUserParams) ([]database.SearchPostsForUserRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	included := []string{}
+	excluded := []string{}
+	for _, word := range strings.Fields(strings.ToLower(strings.ReplaceAll(arg.Query, `"`, " "))) {
+		if word == "or" || word == "-" {
+			continue
+		}
+		if strings.HasPrefix(word, "-") {
+			excluded = append(excluded, word[1:])
+		} else {
+			included = append(included, word)
+		}
+	}
+	if len(included) == 0 {
+		return nil, nil
+	}
+	followed := s.followedFeeds(arg.UserID)
+	rows := []database.SearchPostsForUserRow{}
+	for _, post := range s.posts {
+		if !followed[post.FeedID] {
+			continue
+		}
+		title := strings.ToLower(post.Title)
+		text := title + " " + strings.ToLower(post.Description.String)
+		rank := float32(0)
+		matches := true
+		for _, word := range included {
+			if !strings.Contains(text, word) {
+				matches = false
+				break
+			}
+			rank += float32(strings.Count(title, word)) + 0.4*float32(strings.Count(text, word)-strings.Count(title, word))
+		}
+		for _, word := range excluded {
+			if strings.Contains(text, word) {
+				matches = false
+			}
+		}
+		if !matches {
+			continue
+		}
+		rows = append(rows, database.SearchPostsForUserRow{
+			ID:          post.ID,
+			Title:       post.Title,
+			Url:         post.Url,
+			PublishedAt: post.PublishedAt,
+			FeedName:    s.feeds[post.FeedID].Name,
+			Rank:        rank,
+			Snippet:     snippet(post.Title+" "+post.Description.String, included),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Rank != rows[j].Rank {
+			return rows[i].Rank > rows[j].Rank
+		}
+		return rows[i].PublishedAt.After(rows[j].PublishedAt)
+	})
+	return rows[:min(int(arg.Limit), len(rows))], nil
+}
+
+// Returns up to 20 words of the text around the first match, with the
+// matching words wrapped in asterisks
+func snippet(text string, words []string) string {
+	fields := strings.Fields(text)
+	first := -1
+	for i, field := range fields {
+		for _, word := range words {
+			if strings.Contains(strings.ToLower(field), word) {
+				fields[i] = "*" + field + "*"
+				if first < 0 {
+					first = i
+				}
+				break
+			}
+		}
+	}
+	start := max(first-5, 0)
+	return strings.Join(fields[start:min(start+20, len(fields))], " ")
+}
+
+func (s *Store) SetFeedCacheValidators(ctx context.Context, arg database.SetFeedCacheValidatorsParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	feed, ok := s.feeds[arg.ID]
+	if !ok {
+		return nil
+	}
+	feed.Etag = arg.Etag
+	feed.LastModified = arg.LastModified
+	feed.UpdatedAt = time.Now()
+	s.feeds[arg.ID] = feed
+	return nil
+}
+
+func (s *Store) StarPost(ctx context.Context, arg database.StarPostParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateState(arg.UserID, arg.PostID, func(state *database.PostState) {
+		state.Starred = true
+		state.StarredAt = nullTime(state.UpdatedAt)
+	})
+}
+
+func (s *Store) UnstarPost(ctx context.Context, arg database.UnstarPostParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := stateKey{arg.UserID, arg.PostID}
+	state, ok := s.states[key]
+	if !ok {
+		return nil
+	}
+	state.Starred = false
+	state.StarredAt = sql.NullTime{}
+	state.UpdatedAt = time.Now()
+	s.states[key] = state
+	return nil
+}
+
+func (s *Store) UpdatePostContent(ctx context.Context, arg database.UpdatePostContentParams) (database.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	post, ok := s.posts[arg.ID]
+	if !ok {
+		return database.Post{}, sql.ErrNoRows
+	}
+	post.Title = arg.Title
+	post.Url = arg.Url
+	post.Description = arg.Description
+	post.ContentHash = arg.ContentHash
+	post.UpdatedAt = time.Now()
+	s.posts[arg.ID] = post
+	return post, nil
+}
@@ -11,14 +11,36 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UserID       uuid.UUID
+	Name         string
+	KeyHash      string
+	Prefix       string
+	LastUsedAt   sql.NullTime
+	RevokedAt    sql.NullTime
+	FeverKeyHash sql.NullString
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Name                string
+	Url                 string
+	UserID              uuid.UUID
+	LastFetchedAt       sql.NullTime
+	Etag                sql.NullString
+	LastModified        sql.NullString
+	ClaimedUntil        sql.NullTime
+	LastError           sql.NullString
+	ConsecutiveFailures int32
+	LastSuccessAt       sql.NullTime
+	LastHttpStatus      sql.NullInt32
+	RetryAfter          sql.NullTime
+	Disabled            bool
+	FeverID             int64
 }
 
 type FeedFollow struct {
@@ -38,6 +60,29 @@ type Post struct {
 	Description sql.NullString
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	FeverID     int64
+}
+
+type PostRevision struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	PostID      uuid.UUID
+	Title       string
+	Url         string
+	Description sql.NullString
+}
+
+type PostState struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Read      bool
+	ReadAt    sql.NullTime
+	Starred   bool
+	StarredAt sql.NullTime
 }
 
 type User struct {
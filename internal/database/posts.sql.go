@@ -11,14 +11,64 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const adoptPostGuid = `-- name: AdoptPostGuid :one
+UPDATE posts
+SET guid = $3
+WHERE feed_id = $1 AND url = $2 AND guid = url
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash, fever_id
+`
+
+type AdoptPostGuidParams struct {
+	FeedID uuid.UUID
+	Url    string
+	Guid   string
+}
+
+// Sets the guid of the feed's post that was saved with its URL as guid, as
+// posts stored before guids were. Returns no rows if there is no such post.
+func (q *Queries) AdoptPostGuid(ctx context.Context, arg AdoptPostGuidParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, adoptPostGuid, arg.FeedID, arg.Url, arg.Guid)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.FeverID,
+	)
+	return i, err
+}
+
+const countPostsForUser = `-- name: CountPostsForUser :one
+SELECT COUNT(*) FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = $1
+`
+
+func (q *Queries) CountPostsForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPostsForUser, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createPost = `-- name: CreatePost :one
-INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id)
+INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash)
 VALUES(
-  $1, $2, $3, $4, $5, $6, $7, $8
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
 )
-RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id
+ON CONFLICT (feed_id, guid) DO NOTHING
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash, fever_id
 `
 
 type CreatePostParams struct {
@@ -30,8 +80,11 @@ type CreatePostParams struct {
 	Description sql.NullString
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
 }
 
+// Returns no rows if the feed already has a post with the same guid.
 func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
 	row := q.db.QueryRowContext(ctx, createPost,
 		arg.ID,
@@ -42,7 +95,239 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		arg.Description,
 		arg.PublishedAt,
 		arg.FeedID,
+		arg.Guid,
+		arg.ContentHash,
+	)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.FeverID,
+	)
+	return i, err
+}
+
+const createPostRevision = `-- name: CreatePostRevision :exec
+INSERT INTO post_revisions(id, created_at, post_id, title, url, description)
+VALUES(
+  $1, $2, $3, $4, $5, $6
+)
+`
+
+type CreatePostRevisionParams struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	PostID      uuid.UUID
+	Title       string
+	Url         string
+	Description sql.NullString
+}
+
+func (q *Queries) CreatePostRevision(ctx context.Context, arg CreatePostRevisionParams) error {
+	_, err := q.db.ExecContext(ctx, createPostRevision,
+		arg.ID,
+		arg.CreatedAt,
+		arg.PostID,
+		arg.Title,
+		arg.Url,
+		arg.Description,
+	)
+	return err
+}
+
+const getFeverItemsForUser = `-- name: GetFeverItemsForUser :many
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.fever_id, feeds.fever_id AS feed_fever_id,
+COALESCE(post_states.read, FALSE) AS read,
+COALESCE(post_states.starred, FALSE) AS starred
+FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+LEFT JOIN post_states
+ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1
+AND ($2::bigint IS NULL OR posts.fever_id > $2::bigint)
+AND ($3::bigint IS NULL OR posts.fever_id < $3::bigint)
+AND ($4::bigint[] IS NULL OR posts.fever_id = ANY($4::bigint[]))
+ORDER BY
+  CASE WHEN $3::bigint IS NULL THEN posts.fever_id END ASC,
+  posts.fever_id DESC
+LIMIT $5
+`
+
+type GetFeverItemsForUserParams struct {
+	UserID  uuid.UUID
+	SinceID sql.NullInt64
+	MaxID   sql.NullInt64
+	WithIds []int64
+	Limit   int32
+}
+
+type GetFeverItemsForUserRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	FeverID     int64
+	FeedFeverID int64
+	Read        bool
+	Starred     bool
+}
+
+// Lists the posts of the feeds the user follows by fever_id: those after
+// since_id in ascending order, those before max_id in descending order, or
+// those in with_ids.
+func (q *Queries) GetFeverItemsForUser(ctx context.Context, arg GetFeverItemsForUserParams) ([]GetFeverItemsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getFeverItemsForUser,
+		arg.UserID,
+		arg.SinceID,
+		arg.MaxID,
+		pq.Array(arg.WithIds),
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFeverItemsForUserRow
+	for rows.Next() {
+		var i GetFeverItemsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.FeverID,
+			&i.FeedFeverID,
+			&i.Read,
+			&i.Starred,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPost = `-- name: GetPost :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash, fever_id FROM posts
+WHERE id = $1
+`
+
+func (q *Queries) GetPost(ctx context.Context, id uuid.UUID) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPost, id)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.FeverID,
+	)
+	return i, err
+}
+
+const getPostByFeverID = `-- name: GetPostByFeverID :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash, fever_id FROM posts
+WHERE fever_id = $1
+`
+
+func (q *Queries) GetPostByFeverID(ctx context.Context, feverID int64) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByFeverID, feverID)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.FeverID,
+	)
+	return i, err
+}
+
+const getPostByGuid = `-- name: GetPostByGuid :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash, fever_id FROM posts
+WHERE feed_id = $1 AND guid = $2
+`
+
+type GetPostByGuidParams struct {
+	FeedID uuid.UUID
+	Guid   string
+}
+
+func (q *Queries) GetPostByGuid(ctx context.Context, arg GetPostByGuidParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByGuid, arg.FeedID, arg.Guid)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.FeverID,
 	)
+	return i, err
+}
+
+const getPostForUser = `-- name: GetPostForUser :one
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.fever_id FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+WHERE posts.id = $1 AND feed_follows.user_id = $2
+`
+
+type GetPostForUserParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+// Returns the post if it belongs to a feed the user follows.
+func (q *Queries) GetPostForUser(ctx context.Context, arg GetPostForUserParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostForUser, arg.ID, arg.UserID)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -53,33 +338,97 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.Description,
 		&i.PublishedAt,
 		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.FeverID,
 	)
 	return i, err
 }
 
 const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id FROM posts
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.url, posts.description, posts.published_at, posts.feed_id, posts.guid, posts.content_hash, posts.fever_id, (
+  SELECT COUNT(*) FROM post_revisions
+  WHERE post_revisions.post_id = posts.id
+) AS revisions, COALESCE(post_states.read, FALSE) AS read,
+COALESCE(post_states.starred, FALSE) AS starred
+FROM posts
 INNER JOIN feed_follows
 ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+LEFT JOIN post_states
+ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
 WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2
+AND (NOT $2::bool OR post_states.read IS NOT TRUE)
+AND ($3::text IS NULL OR feeds.url = $3::text OR feeds.name = $3::text)
+AND ($4::timestamp IS NULL OR posts.published_at >= $4::timestamp)
+AND ($5::timestamp IS NULL OR posts.published_at < $5::timestamp)
+AND (
+  $6::timestamp IS NULL
+  OR ($7::bool AND (posts.published_at, posts.id) > ($6::timestamp, $8::uuid))
+  OR (NOT $7::bool AND (posts.published_at, posts.id) < ($6::timestamp, $8::uuid))
+)
+ORDER BY
+  CASE WHEN $7::bool THEN posts.published_at END ASC,
+  CASE WHEN $7::bool THEN posts.id END ASC,
+  CASE WHEN NOT $7::bool THEN posts.published_at END DESC,
+  CASE WHEN NOT $7::bool THEN posts.id END DESC
+LIMIT $9 OFFSET $10
 `
 
 type GetPostsForUserParams struct {
-	UserID uuid.UUID
-	Limit  int32
+	UserID           uuid.UUID
+	UnreadOnly       bool
+	Feed             sql.NullString
+	Since            sql.NullTime
+	Until            sql.NullTime
+	AfterPublishedAt sql.NullTime
+	SortAsc          bool
+	AfterID          uuid.NullUUID
+	Limit            int32
+	Offset           int32
+}
+
+type GetPostsForUserRow struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedID      uuid.UUID
+	Guid        string
+	ContentHash string
+	FeverID     int64
+	Revisions   int64
+	Read        bool
+	Starred     bool
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]Post, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.UserID, arg.Limit)
+// Lists the posts of the feeds the user follows. All filters are optional.
+// Paging works either with an offset or by continuing after a given post,
+// identified by its published_at and id.
+func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsForUser,
+		arg.UserID,
+		arg.UnreadOnly,
+		arg.Feed,
+		arg.Since,
+		arg.Until,
+		arg.AfterPublishedAt,
+		arg.SortAsc,
+		arg.AfterID,
+		arg.Limit,
+		arg.Offset,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Post
+	var items []GetPostsForUserRow
 	for rows.Next() {
-		var i Post
+		var i GetPostsForUserRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.CreatedAt,
@@ -89,6 +438,85 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.Description,
 			&i.PublishedAt,
 			&i.FeedID,
+			&i.Guid,
+			&i.ContentHash,
+			&i.FeverID,
+			&i.Revisions,
+			&i.Read,
+			&i.Starred,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const searchPostsForUser = `-- name: SearchPostsForUser :many
+SELECT posts.id, posts.title, posts.url, posts.published_at, feeds.name AS feed_name,
+  ts_rank(
+    setweight(to_tsvector('english', COALESCE(posts.title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(posts.description, '')), 'B'),
+    search_query) AS rank,
+  ts_headline('english', posts.title || ' ' || COALESCE(posts.description, ''), search_query,
+    'StartSel=*, StopSel=*, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet
+FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+CROSS JOIN websearch_to_tsquery('english', $1) AS search_query
+WHERE feed_follows.user_id = $2
+AND (
+  setweight(to_tsvector('english', COALESCE(posts.title, '')), 'A') ||
+  setweight(to_tsvector('english', COALESCE(posts.description, '')), 'B')
+) @@ search_query
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT $3
+`
+
+type SearchPostsForUserParams struct {
+	Query  string
+	UserID uuid.UUID
+	Limit  int32
+}
+
+type SearchPostsForUserRow struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	PublishedAt time.Time
+	FeedName    string
+	Rank        float32
+	Snippet     string
+}
+
+// Full-text search over the posts of the feeds the user follows, best
+// matches first. Matches in the snippet are wrapped in asterisks. The
+// searched document is the expression indexed by posts_search_idx.
+func (q *Queries) SearchPostsForUser(ctx context.Context, arg SearchPostsForUserParams) ([]SearchPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchPostsForUser, arg.Query, arg.UserID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchPostsForUserRow
+	for rows.Next() {
+		var i SearchPostsForUserRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Title,
+			&i.Url,
+			&i.PublishedAt,
+			&i.FeedName,
+			&i.Rank,
+			&i.Snippet,
 		); err != nil {
 			return nil, err
 		}
@@ -102,3 +530,43 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const updatePostContent = `-- name: UpdatePostContent :one
+UPDATE posts
+SET title = $2, url = $3, description = $4, content_hash = $5, updated_at = NOW()
+WHERE posts.id = $1
+RETURNING id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash, fever_id
+`
+
+type UpdatePostContentParams struct {
+	ID          uuid.UUID
+	Title       string
+	Url         string
+	Description sql.NullString
+	ContentHash string
+}
+
+func (q *Queries) UpdatePostContent(ctx context.Context, arg UpdatePostContentParams) (Post, error) {
+	row := q.db.QueryRowContext(ctx, updatePostContent,
+		arg.ID,
+		arg.Title,
+		arg.Url,
+		arg.Description,
+		arg.ContentHash,
+	)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Guid,
+		&i.ContentHash,
+		&i.FeverID,
+	)
+	return i, err
+}
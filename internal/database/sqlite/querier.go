@@ -0,0 +1,621 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhiillos/gator/internal/database"
+)
+
+// Querier runs the queries of the database package against a SQLite
+// database. SQLite stores timestamps as text, so all times are converted to
+// UTC to keep them comparable, and the current time is passed in from Go.
+type Querier struct {
+	q *Queries
+}
+
+var _ database.Querier = (*Querier)(nil)
+
+// Returns a Querier using the given SQLite connection
+func NewQuerier(db DBTX) *Querier {
+	return &Querier{q: New(db)}
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
+
+func nullUTC(t sql.NullTime) sql.NullTime {
+	if t.Valid {
+		t.Time = t.Time.UTC()
+	}
+	return t
+}
+
+func nullInt64(i sql.NullInt32) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(i.Int32), Valid: i.Valid}
+}
+
+func nullInt32(i sql.NullInt64) sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(i.Int64), Valid: i.Valid}
+}
+
+func toFeed(f Feed) database.Feed {
+	return database.Feed{
+		ID:                  f.ID,
+		CreatedAt:           f.CreatedAt,
+		UpdatedAt:           f.UpdatedAt,
+		Name:                f.Name,
+		Url:                 f.Url,
+		UserID:              f.UserID,
+		LastFetchedAt:       f.LastFetchedAt,
+		Etag:                f.Etag,
+		LastModified:        f.LastModified,
+		ClaimedUntil:        f.ClaimedUntil,
+		LastError:           f.LastError,
+		ConsecutiveFailures: int32(f.ConsecutiveFailures),
+		LastSuccessAt:       f.LastSuccessAt,
+		LastHttpStatus:      nullInt32(f.LastHttpStatus),
+		RetryAfter:          f.RetryAfter,
+		Disabled:            f.Disabled,
+		FeverID:             f.FeverID,
+	}
+}
+
+func toPost(p Post) database.Post {
+	return database.Post{
+		ID:          p.ID,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+		Title:       p.Title,
+		Url:         p.Url,
+		Description: p.Description,
+		PublishedAt: p.PublishedAt,
+		FeedID:      p.FeedID,
+		Guid:        p.Guid,
+		ContentHash: p.ContentHash,
+		FeverID:     p.FeverID,
+	}
+}
+
+func toUser(u User) database.User {
+	return database.User{
+		ID:        u.ID,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+		Name:      u.Name,
+	}
+}
+
+// Translates a PostgreSQL websearch query into an FTS5 query. Words and
+// quoted phrases must all match, "or" matches either side and a leading "-"
+// excludes a word. Every term is quoted so that no input is an FTS5 syntax
+// error.
+func ftsQuery(query string) string {
+	terms := []string{}
+	excluded := []string{}
+	for query = strings.TrimSpace(query); query != ""; query = strings.TrimSpace(query) {
+		negate := strings.HasPrefix(query, "-")
+		if negate {
+			query = query[1:]
+		}
+		var term string
+		if strings.HasPrefix(query, `"`) {
+			end := strings.Index(query[1:], `"`)
+			if end < 0 {
+				term, query = query[1:], ""
+			} else {
+				term, query = query[1:end+1], query[end+2:]
+			}
+		} else {
+			end := strings.IndexAny(query, " \t\n")
+			if end < 0 {
+				term, query = query, ""
+			} else {
+				term, query = query[:end], query[end:]
+			}
+		}
+		if strings.TrimSpace(term) == "" {
+			continue
+		}
+		if !negate && strings.EqualFold(term, "or") {
+			if len(terms) > 0 && terms[len(terms)-1] != "OR" {
+				terms = append(terms, "OR")
+			}
+			continue
+		}
+		quoted := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if negate {
+			excluded = append(excluded, quoted)
+		} else {
+			terms = append(terms, quoted)
+		}
+	}
+	if len(terms) > 0 && terms[len(terms)-1] == "OR" {
+		terms = terms[:len(terms)-1]
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	fts := "(" + strings.Join(terms, " ") + ")"
+	for _, term := range excluded {
+		fts += " NOT " + term
+	}
+	return fts
+}
+
+func (s *Querier) AdoptPostGuid(ctx context.Context, arg database.AdoptPostGuidParams) (database.Post, error) {
+	post, err := s.q.AdoptPostGuid(ctx, AdoptPostGuidParams{
+		Guid:   arg.Guid,
+		FeedID: arg.FeedID,
+		Url:    arg.Url,
+	})
+	return toPost(post), err
+}
+
+func (s *Querier) ClaimNextFeedsToFetch(ctx context.Context, arg database.ClaimNextFeedsToFetchParams) ([]database.Feed, error) {
+	t := now()
+	feeds, err := s.q.ClaimNextFeedsToFetch(ctx, ClaimNextFeedsToFetchParams{
+		ClaimedUntil:  sql.NullTime{Time: t.Add(time.Duration(arg.LeaseSeconds) * time.Second), Valid: true},
+		Now:           sql.NullTime{Time: t, Valid: true},
+		FetchedBefore: sql.NullTime{Time: utc(arg.FetchedBefore), Valid: true},
+		BatchSize:     int64(arg.BatchSize),
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := []database.Feed{}
+	for _, feed := range feeds {
+		items = append(items, toFeed(feed))
+	}
+	return items, nil
+}
+
+func (s *Querier) CountPostsForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.q.CountPostsForUser(ctx, userID)
+}
+
+func (s *Querier) CreateAPIKey(ctx context.Context, arg database.CreateAPIKeyParams) (database.ApiKey, error) {
+	key, err := s.q.CreateAPIKey(ctx, CreateAPIKeyParams{
+		ID:           arg.ID,
+		CreatedAt:    utc(arg.CreatedAt),
+		UserID:       arg.UserID,
+		Name:         arg.Name,
+		KeyHash:      arg.KeyHash,
+		Prefix:       arg.Prefix,
+		FeverKeyHash: arg.FeverKeyHash,
+	})
+	return database.ApiKey(key), err
+}
+
+func (s *Querier) CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error) {
+	feed, err := s.q.CreateFeed(ctx, CreateFeedParams{
+		ID:        arg.ID,
+		CreatedAt: utc(arg.CreatedAt),
+		UpdatedAt: utc(arg.UpdatedAt),
+		Name:      arg.Name,
+		Url:       arg.Url,
+		UserID:    arg.UserID,
+	})
+	return toFeed(feed), err
+}
+
+func (s *Querier) CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.CreateFeedFollowRow, error) {
+	row, err := s.q.CreateFeedFollow(ctx, CreateFeedFollowParams{
+		ID:        arg.ID,
+		CreatedAt: utc(arg.CreatedAt),
+		UpdatedAt: utc(arg.UpdatedAt),
+		UserID:    arg.UserID,
+		FeedID:    arg.FeedID,
+	})
+	return database.CreateFeedFollowRow(row), err
+}
+
+func (s *Querier) CreatePost(ctx context.Context, arg database.CreatePostParams) (database.Post, error) {
+	post, err := s.q.CreatePost(ctx, CreatePostParams{
+		ID:          arg.ID,
+		CreatedAt:   utc(arg.CreatedAt),
+		UpdatedAt:   utc(arg.UpdatedAt),
+		Title:       arg.Title,
+		Url:         arg.Url,
+		Description: arg.Description,
+		PublishedAt: utc(arg.PublishedAt),
+		FeedID:      arg.FeedID,
+		Guid:        arg.Guid,
+		ContentHash: arg.ContentHash,
+	})
+	return toPost(post), err
+}
+
+func (s *Querier) CreatePostRevision(ctx context.Context, arg database.CreatePostRevisionParams) error {
+	return s.q.CreatePostRevision(ctx, CreatePostRevisionParams{
+		ID:          arg.ID,
+		CreatedAt:   utc(arg.CreatedAt),
+		PostID:      arg.PostID,
+		Title:       arg.Title,
+		Url:         arg.Url,
+		Description: arg.Description,
+	})
+}
+
+func (s *Querier) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	user, err := s.q.CreateUser(ctx, CreateUserParams{
+		ID:        arg.ID,
+		CreatedAt: utc(arg.CreatedAt),
+		UpdatedAt: utc(arg.UpdatedAt),
+		Name:      arg.Name,
+	})
+	return toUser(user), err
+}
+
+func (s *Querier) DeleteFeedFollow(ctx context.Context, arg database.DeleteFeedFollowParams) error {
+	return s.q.DeleteFeedFollow(ctx, DeleteFeedFollowParams(arg))
+}
+
+func (s *Querier) EnableFeed(ctx context.Context, id uuid.UUID) error {
+	return s.q.EnableFeed(ctx, EnableFeedParams{Now: now(), ID: id})
+}
+
+func (s *Querier) GetAPIKeysForUser(ctx context.Context, userID uuid.UUID) ([]database.ApiKey, error) {
+	keys, err := s.q.GetAPIKeysForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	items := []database.ApiKey{}
+	for _, key := range keys {
+		items = append(items, database.ApiKey(key))
+	}
+	return items, nil
+}
+
+func (s *Querier) GetFeedByFeverID(ctx context.Context, feverID int64) (database.Feed, error) {
+	feed, err := s.q.GetFeedByFeverID(ctx, feverID)
+	return toFeed(feed), err
+}
+
+func (s *Querier) GetFeedByUrl(ctx context.Context, url string) (database.Feed, error) {
+	feed, err := s.q.GetFeedByUrl(ctx, url)
+	return toFeed(feed), err
+}
+
+func (s *Querier) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetFeedFollowsForUserRow, error) {
+	rows, err := s.q.GetFeedFollowsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	items := []database.GetFeedFollowsForUserRow{}
+	for _, row := range rows {
+		items = append(items, database.GetFeedFollowsForUserRow(row))
+	}
+	return items, nil
+}
+
+func (s *Querier) GetFeedsWithCreators(ctx context.Context) ([]database.GetFeedsWithCreatorsRow, error) {
+	rows, err := s.q.GetFeedsWithCreators(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items := []database.GetFeedsWithCreatorsRow{}
+	for _, row := range rows {
+		items = append(items, database.GetFeedsWithCreatorsRow{
+			ID:                  row.ID,
+			CreatedAt:           row.CreatedAt,
+			UpdatedAt:           row.UpdatedAt,
+			Name:                row.Name,
+			Url:                 row.Url,
+			LastFetchedAt:       row.LastFetchedAt,
+			ConsecutiveFailures: int32(row.ConsecutiveFailures),
+			LastError:           row.LastError,
+			LastSuccessAt:       row.LastSuccessAt,
+			LastHttpStatus:      nullInt32(row.LastHttpStatus),
+			Disabled:            row.Disabled,
+			UserName:            row.UserName,
+		})
+	}
+	return items, nil
+}
+
+func (s *Querier) GetFeverItemsForUser(ctx context.Context, arg database.GetFeverItemsForUserParams) ([]database.GetFeverItemsForUserRow, error) {
+	params := GetFeverItemsForUserParams{
+		UserID:  arg.UserID,
+		SinceID: arg.SinceID,
+		MaxID:   arg.MaxID,
+		Limit:   int64(arg.Limit),
+	}
+	// SQLite has no arrays, so the IDs are passed as a JSON array
+	if arg.WithIds != nil {
+		ids, err := json.Marshal(arg.WithIds)
+		if err != nil {
+			return nil, err
+		}
+		params.WithIds = sql.NullString{String: string(ids), Valid: true}
+	}
+	rows, err := s.q.GetFeverItemsForUser(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	items := []database.GetFeverItemsForUserRow{}
+	for _, row := range rows {
+		items = append(items, database.GetFeverItemsForUserRow{
+			ID:          row.ID,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+			Title:       row.Title,
+			Url:         row.Url,
+			Description: row.Description,
+			PublishedAt: row.PublishedAt,
+			FeedID:      row.FeedID,
+			Guid:        row.Guid,
+			ContentHash: row.ContentHash,
+			FeverID:     row.FeverID,
+			FeedFeverID: row.FeedFeverID,
+			Read:        row.Read,
+			Starred:     row.Starred,
+		})
+	}
+	return items, nil
+}
+
+func (s *Querier) GetFollowedFeeds(ctx context.Context, userID uuid.UUID) ([]database.Feed, error) {
+	feeds, err := s.q.GetFollowedFeeds(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	items := []database.Feed{}
+	for _, feed := range feeds {
+		items = append(items, toFeed(feed))
+	}
+	return items, nil
+}
+
+func (s *Querier) GetPost(ctx context.Context, id uuid.UUID) (database.Post, error) {
+	post, err := s.q.GetPost(ctx, id)
+	return toPost(post), err
+}
+
+func (s *Querier) GetPostByFeverID(ctx context.Context, feverID int64) (database.Post, error) {
+	post, err := s.q.GetPostByFeverID(ctx, feverID)
+	return toPost(post), err
+}
+
+func (s *Querier) GetPostByGuid(ctx context.Context, arg database.GetPostByGuidParams) (database.Post, error) {
+	post, err := s.q.GetPostByGuid(ctx, GetPostByGuidParams(arg))
+	return toPost(post), err
+}
+
+func (s *Querier) GetPostForUser(ctx context.Context, arg database.GetPostForUserParams) (database.Post, error) {
+	post, err := s.q.GetPostForUser(ctx, GetPostForUserParams(arg))
+	return toPost(post), err
+}
+
+func (s *Querier) GetPostsForUser(ctx context.Context, arg database.GetPostsForUserParams) ([]database.GetPostsForUserRow, error) {
+	rows, err := s.q.GetPostsForUser(ctx, GetPostsForUserParams{
+		UserID:           arg.UserID,
+		UnreadOnly:       arg.UnreadOnly,
+		Feed:             arg.Feed,
+		Since:            nullUTC(arg.Since),
+		Until:            nullUTC(arg.Until),
+		AfterPublishedAt: nullUTC(arg.AfterPublishedAt),
+		SortAsc:          arg.SortAsc,
+		AfterID:          arg.AfterID,
+		Limit:            int64(arg.Limit),
+		Offset:           int64(arg.Offset),
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := []database.GetPostsForUserRow{}
+	for _, row := range rows {
+		items = append(items, database.GetPostsForUserRow{
+			ID:          row.ID,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+			Title:       row.Title,
+			Url:         row.Url,
+			Description: row.Description,
+			PublishedAt: row.PublishedAt,
+			FeedID:      row.FeedID,
+			Guid:        row.Guid,
+			ContentHash: row.ContentHash,
+			FeverID:     row.FeverID,
+			Revisions:   row.Revisions,
+			Read:        row.Read,
+			Starred:     row.Starred,
+		})
+	}
+	return items, nil
+}
+
+func (s *Querier) GetStarredFeverIDs(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	return s.q.GetStarredFeverIDs(ctx, userID)
+}
+
+func (s *Querier) GetStarredPostsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetStarredPostsForUserRow, error) {
+	rows, err := s.q.GetStarredPostsForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	items := []database.GetStarredPostsForUserRow{}
+	for _, row := range rows {
+		items = append(items, database.GetStarredPostsForUserRow{
+			ID:          row.ID,
+			CreatedAt:   row.CreatedAt,
+			UpdatedAt:   row.UpdatedAt,
+			Title:       row.Title,
+			Url:         row.Url,
+			Description: row.Description,
+			PublishedAt: row.PublishedAt,
+			FeedID:      row.FeedID,
+			Guid:        row.Guid,
+			ContentHash: row.ContentHash,
+			FeverID:     row.FeverID,
+			Read:        row.Read,
+			StarredAt:   row.StarredAt,
+		})
+	}
+	return items, nil
+}
+
+func (s *Querier) GetUnreadFeverIDs(ctx context.Context, userID uuid.UUID) ([]int64, error) {
+	return s.q.GetUnreadFeverIDs(ctx, userID)
+}
+
+func (s *Querier) GetUser(ctx context.Context, name string) (database.User, error) {
+	user, err := s.q.GetUser(ctx, name)
+	return toUser(user), err
+}
+
+func (s *Querier) GetUserByAPIKey(ctx context.Context, keyHash string) (database.User, error) {
+	user, err := s.q.GetUserByAPIKey(ctx, keyHash)
+	return toUser(user), err
+}
+
+func (s *Querier) GetUserByFeverKey(ctx context.Context, feverKeyHash string) (database.User, error) {
+	user, err := s.q.GetUserByFeverKey(ctx, feverKeyHash)
+	return toUser(user), err
+}
+
+func (s *Querier) GetUsers(ctx context.Context) ([]database.User, error) {
+	users, err := s.q.GetUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	items := []database.User{}
+	for _, user := range users {
+		items = append(items, toUser(user))
+	}
+	return items, nil
+}
+
+func (s *Querier) MarkAPIKeyUsed(ctx context.Context, keyHash string) error {
+	return s.q.MarkAPIKeyUsed(ctx, MarkAPIKeyUsedParams{
+		Now:     sql.NullTime{Time: now(), Valid: true},
+		KeyHash: keyHash,
+	})
+}
+
+func (s *Querier) MarkAllPostsRead(ctx context.Context, arg database.MarkAllPostsReadParams) (int64, error) {
+	return s.q.MarkAllPostsRead(ctx, MarkAllPostsReadParams{
+		Now:    now(),
+		UserID: arg.UserID,
+		FeedID: arg.FeedID,
+		Before: nullUTC(arg.Before),
+	})
+}
+
+func (s *Querier) MarkFeedFetched(ctx context.Context, id uuid.UUID) error {
+	return s.q.MarkFeedFetched(ctx, MarkFeedFetchedParams{
+		Now: sql.NullTime{Time: now(), Valid: true},
+		ID:  id,
+	})
+}
+
+func (s *Querier) MarkPostRead(ctx context.Context, arg database.MarkPostReadParams) error {
+	return s.q.MarkPostRead(ctx, MarkPostReadParams{UserID: arg.UserID, PostID: arg.PostID, Now: now()})
+}
+
+func (s *Querier) MarkPostUnread(ctx context.Context, arg database.MarkPostUnreadParams) error {
+	return s.q.MarkPostUnread(ctx, MarkPostUnreadParams{UserID: arg.UserID, PostID: arg.PostID, Now: now()})
+}
+
+func (s *Querier) RecordFeedFailure(ctx context.Context, arg database.RecordFeedFailureParams) (database.Feed, error) {
+	t := now()
+	feed, err := s.q.RecordFeedFailure(ctx, RecordFeedFailureParams{
+		LastError:      arg.LastError,
+		LastHttpStatus: nullInt64(arg.LastHttpStatus),
+		RetryAfter:     sql.NullTime{Time: t.Add(time.Duration(arg.BackoffSeconds) * time.Second), Valid: true},
+		MaxFailures:    int64(arg.MaxFailures),
+		Now:            t,
+		ID:             arg.ID,
+	})
+	return toFeed(feed), err
+}
+
+func (s *Querier) RecordFeedSuccess(ctx context.Context, arg database.RecordFeedSuccessParams) error {
+	return s.q.RecordFeedSuccess(ctx, RecordFeedSuccessParams{
+		LastHttpStatus: nullInt64(arg.LastHttpStatus),
+		Now:            sql.NullTime{Time: now(), Valid: true},
+		ID:             arg.ID,
+	})
+}
+
+func (s *Querier) ReleaseFeedClaim(ctx context.Context, id uuid.UUID) error {
+	return s.q.ReleaseFeedClaim(ctx, id)
+}
+
+func (s *Querier) ResetUsers(ctx context.Context) error {
+	return s.q.ResetUsers(ctx)
+}
+
+func (s *Querier) RevokeAPIKey(ctx context.Context, arg database.RevokeAPIKeyParams) (int64, error) {
+	return s.q.RevokeAPIKey(ctx, RevokeAPIKeyParams{
+		Now:    sql.NullTime{Time: now(), Valid: true},
+		ID:     arg.ID,
+		UserID: arg.UserID,
+	})
+}
+
+func (s *Querier) SearchPostsForUser(ctx context.Context, arg database.SearchPostsForUserParams) ([]database.SearchPostsForUserRow, error) {
+	query := ftsQuery(arg.Query)
+	if query == "" {
+		return nil, nil
+	}
+	rows, err := s.q.SearchPostsForUser(ctx, SearchPostsForUserParams{
+		Query:  query,
+		UserID: arg.UserID,
+		Limit:  int64(arg.Limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := []database.SearchPostsForUserRow{}
+	for _, row := range rows {
+		items = append(items, database.SearchPostsForUserRow{
+			ID:          row.ID,
+			Title:       row.Title,
+			Url:         row.Url,
+			PublishedAt: row.PublishedAt,
+			FeedName:    row.FeedName,
+			Rank:        float32(row.Rank),
+			Snippet:     row.Snippet,
+		})
+	}
+	return items, nil
+}
+
+func (s *Querier) SetFeedCacheValidators(ctx context.Context, arg database.SetFeedCacheValidatorsParams) error {
+	return s.q.SetFeedCacheValidators(ctx, SetFeedCacheValidatorsParams{
+		Etag:         arg.Etag,
+		LastModified: arg.LastModified,
+		Now:          now(),
+		ID:           arg.ID,
+	})
+}
+
+func (s *Querier) StarPost(ctx context.Context, arg database.StarPostParams) error {
+	return s.q.StarPost(ctx, StarPostParams{UserID: arg.UserID, PostID: arg.PostID, Now: now()})
+}
+
+func (s *Querier) UnstarPost(ctx context.Context, arg database.UnstarPostParams) error {
+	return s.q.UnstarPost(ctx, UnstarPostParams{Now: now(), UserID: arg.UserID, PostID: arg.PostID})
+}
+
+func (s *Querier) UpdatePostContent(ctx context.Context, arg database.UpdatePostContentParams) (database.Post, error) {
+	post, err := s.q.UpdatePostContent(ctx, UpdatePostContentParams{
+		Title:       arg.Title,
+		Url:         arg.Url,
+		Description: arg.Description,
+		ContentHash: arg.ContentHash,
+		Now:         now(),
+		ID:          arg.ID,
+	})
+	return toPost(post), err
+}
@@ -2,16 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
-	"encoding/xml"
+	"encoding/hex"
 	"errors"
+	"flag"
 	"fmt"
 	"html"
 	"io"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,19 +24,12 @@ import (
 )
 
 type state struct {
-	db *database.Queries
+	db database.Querier
+	conn *sql.DB
+	backend backend
 	cfg *config.Config
-}
-
-// Stores command names and their arguments
-type command struct {
-	name string
-	args []string
-}
-
-// Stores all available commands
-type commands struct {
-	commands map[string]func(*state, command) error
+	// Checks that the database schema is up to date before running commands
+	checkSchema func() error
 }
 
 // For reading RSS data
@@ -51,31 +47,14 @@ type RSSItem struct {
 		Link string        `xml:"link"`
 		Description string `xml:"description"`
 		PubDate string     `xml:"pubDate"`
-}
-
-// This function calls the handlers for different commands
-func (c *commands) run(s *state, cmd command) error {
-	fun, ok := c.commands[cmd.name]
-	if !ok {
-		return errors.New("Command does not exist")
-	}
-	err := fun(s, cmd)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-// This function registers a new a new handler function for a command name
-func (c *commands) register(name string, f func(*state, command) error) {
-	c.commands[name] = f
+		GUID string        `xml:"guid"`
+		// Fallback dates when pubDate is missing or unparseable
+		Updated string     `xml:"updated"`
+		DCDate string      `xml:"http://purl.org/dc/elements/1.1/ date"`
 }
 
 // Sets the user ("login")
 func handlerLogin(s *state, cmd command) error {
-	if len(cmd.args) != 1 {
-		return errors.New("Please state the username as the argument")
-	}
 	userName := cmd.args[0]
 	_, err := s.db.GetUser(context.Background(), userName)
 	if err != nil {
@@ -91,9 +70,6 @@ func handlerLogin(s *state, cmd command) error {
 
 // Adds a new user to db
 func handlerRegister(s *state, cmd command) error {
-	if len(cmd.args) != 1 {
-		return errors.New("Please state the username to register")
-	}
 	userName := cmd.args[0]
 	user, err := s.db.CreateUser(context.Background(), database.CreateUserParams{
 		ID: uuid.New(),
@@ -130,36 +106,64 @@ func handlerUsers(s *state, cmd command) error {
 		return err
 	}
 	currentUser := s.cfg.CurrentUsername
-	for _, user := range users {
-		userStr := fmt.Sprintf("* %s", user.Name)
-		if user.Name == currentUser {
-			userStr += " (current)"
+	return render(cmd, userOutputs(users, currentUser), func() {
+		for _, user := range users {
+			userStr := fmt.Sprintf("* %s", user.Name)
+			if user.Name == currentUser {
+				userStr += " (current)"
+			}
+			fmt.Printf("%s\n", userStr)
 		}
-		fmt.Printf("%s\n", userStr)
-	}
-	return nil
+	})
 }
 
-func fetchFeed (ctx context.Context, feedURL string) (*RSSFeed, error) {
+// Cache validators from the previous fetch of a feed, used for conditional GETs
+type feedValidators struct {
+	ETag         string
+	LastModified string
+	// Status code of the latest response, filled in by fetchFeed
+	StatusCode   int
+}
+
+// Returned by fetchFeed when the server responds with 304 Not Modified
+var errNotModified = errors.New("Feed not modified")
+
+// Fetches a feed with the client, which must give up well before the claim on
+// the feed expires
+func fetchFeed (ctx context.Context, client *http.Client, feedURL string, validators *feedValidators) (*RSSFeed, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("user-agent", "gator")
-	c := http.Client{}
-	res, err := c.Do(req)
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+	res, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("Error fetching RSS Feed with status %d: %s", res.StatusCode, res.Body)
+		return nil, fmt.Errorf("Error fetching RSS Feed: %w", err)
 	}
 	defer res.Body.Close()
+	validators.StatusCode = res.StatusCode
+	if res.StatusCode == http.StatusNotModified {
+		return nil, errNotModified
+	}
+	if res.StatusCode >= 400 {
+		return nil, fmt.Errorf("Error fetching RSS Feed with status %d", res.StatusCode)
+	}
+	// Remember the validators for the next fetch
+	validators.ETag = res.Header.Get("ETag")
+	validators.LastModified = res.Header.Get("Last-Modified")
 	raw, err := io.ReadAll(res.Body)
 	if err != nil {
 		return nil, errors.New("Error reading bytes from response")
 	}
-	rss := &RSSFeed{}
-	err = xml.Unmarshal(raw, rss)
+	rss, err := parseFeed(raw, res.Header.Get("Content-Type"))
 	if err != nil {
-		return nil, errors.New("Error unmarshaling XML")
+		return nil, err
 	}
 
 	// Decode escaped HTML entities
@@ -174,16 +178,26 @@ func fetchFeed (ctx context.Context, feedURL string) (*RSSFeed, error) {
 
 // Adds a feed
 func handlerAddfeed(s *state, cmd command) error {
-	if len(cmd.args) != 2 {
-		return errors.New("Please pass the Name and URL of the feed as arguments")
-	}
 	name := cmd.args[0]
-	url := cmd.args[1]
 	currentUser := s.cfg.CurrentUsername
 	usr, err := s.db.GetUser(context.Background(), currentUser)
 	if err != nil {
 		return fmt.Errorf("User %q not found", currentUser)
 	}
+	// Find the feed if the URL is of a web page
+	url, advertised, err := discoverFeedURL(context.Background(), documentClient, cmd.args[1])
+	if len(advertised) > 1 {
+		fmt.Printf("Page %s advertises several feeds:\n", cmd.args[1])
+		for _, candidate := range advertised {
+			fmt.Printf("  - %s\n", candidate)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if url != cmd.args[1] {
+		fmt.Printf("Using feed %s found from %s\n", url, cmd.args[1])
+	}
 	resFeed, err := s.db.CreateFeed(context.Background(), database.CreateFeedParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
@@ -211,20 +225,31 @@ func handlerAddfeed(s *state, cmd command) error {
 	return nil
 }
 
-// 
+// Collects feeds at the given interval, fetching up to concurrency feeds in parallel
 func handlerAgg(s *state, cmd command) error {
-	if len(cmd.args) != 1 {
-		return errors.New("Please provide time between requests as a duration string")
-	}
 	timeBetweenRequests, err := time.ParseDuration(cmd.args[0])
 	if err != nil {
 		return errors.New("Please provide a valid duration string")
 	}
+	client := newPublicDocumentClient()
+	if cmd.boolFlag("allow-private-feeds") {
+		client = documentClient
+	}
+	concurrency := 1
+	if len(cmd.args) == 2 {
+		concurrency, err = strconv.Atoi(cmd.args[1])
+		if err != nil || concurrency < 1 {
+			return usageError("Concurrency must be a positive number")
+		}
+	}
 
-	fmt.Printf("Collecting feeds every %s\n", timeBetweenRequests)
+	fmt.Printf("Collecting feeds every %s with %d workers\n", timeBetweenRequests, concurrency)
 	ticker := time.NewTicker(timeBetweenRequests)
 	for ; ; <- ticker.C {
-		scrapeFeeds(s)
+		err := scrapeFeeds(s, client, concurrency)
+		if err != nil {
+			fmt.Printf("Error scraping feeds: %v\n", err)
+		}
 	}
 }
 
@@ -234,18 +259,54 @@ func handlerFeeds(s *state, cmd command) error {
 	if err != nil {
 		return fmt.Errorf("Error getting feeds: %q", err)
 	}
-	fmt.Printf("List of feeds:\n")
-	for _, feed := range feeds {
-		fmt.Printf("Name: %s, URL: %s, CreatedBy: %s\n", feed.Name, feed.Url, feed.UserName)
+	return render(cmd, feedOutputs(feeds), func() {
+		fmt.Printf("List of feeds:\n")
+		for _, feed := range feeds {
+			fmt.Printf("Name: %s, URL: %s, CreatedBy: %s\n", feed.Name, feed.Url, feed.UserName)
+			fmt.Printf("  Health: %s\n", feedHealth(feed))
+		}
+	})
+}
+
+// Describes the fetch health of a feed for the feeds listing
+func feedHealth(feed database.GetFeedsWithCreatorsRow) string {
+	lastSuccess := "never"
+	if feed.LastSuccessAt.Valid {
+		lastSuccess = feed.LastSuccessAt.Time.Format(time.RFC1123)
+	}
+	lastStatus := "N/A"
+	if feed.LastHttpStatus.Valid {
+		lastStatus = strconv.Itoa(int(feed.LastHttpStatus.Int32))
 	}
+	health := "OK"
+	if feed.Disabled {
+		health = "DISABLED"
+	} else if feed.ConsecutiveFailures > 0 {
+		health = "FAILING"
+	}
+	str := fmt.Sprintf("%s, last success: %s, last HTTP status: %s", health, lastSuccess, lastStatus)
+	if feed.ConsecutiveFailures > 0 {
+		str += fmt.Sprintf(", consecutive failures: %d, last error: %s", feed.ConsecutiveFailures, feed.LastError.String)
+	}
+	return str
+}
+
+// Re-enables a feed that was disabled after repeated fetch failures
+func handlerEnableFeed(s *state, cmd command) error {
+	feed, err := s.db.GetFeedByUrl(context.Background(), cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("URL %q does not exist in db", cmd.args[0])
+	}
+	err = s.db.EnableFeed(context.Background(), feed.ID)
+	if err != nil {
+		return fmt.Errorf("Error enabling feed: %w", err)
+	}
+	fmt.Printf("Feed %s enabled\n", feed.Name)
 	return nil
 }
 
 // Adds the current user to follow an RSS feed
 func handlerFollow(s *state, cmd command) error {
-	if len(cmd.args) != 1 {
-		return errors.New("Please pass URL as an argument")
-	}
 	feed, err := s.db.GetFeedByUrl(context.Background(), cmd.args[0])
 	if err != nil {
 		return fmt.Errorf("URL %q does not exist in db", cmd.args[0])
@@ -272,17 +333,15 @@ func handlerFollowing(s *state, cmd command) error {
 	if err != nil {
 		return fmt.Errorf("User %q does not follow any feeds", s.cfg.CurrentUsername)
 	}
-	fmt.Printf("User %q is following:\n", s.cfg.CurrentUsername)
-	for _, feedFollow := range(feedFollows) {
-		fmt.Printf("  - %s\n", feedFollow.FeedName)
-	}
-	return nil
+	return render(cmd, followOutputs(feedFollows), func() {
+		fmt.Printf("User %q is following:\n", s.cfg.CurrentUsername)
+		for _, feedFollow := range(feedFollows) {
+			fmt.Printf("  - %s\n", feedFollow.FeedName)
+		}
+	})
 }
 
 func handlerUnfollow(s *state, cmd command) error {
-	if len(cmd.args) != 1 {
-		return errors.New("Please provide the feed URL to unfollow")
-	}
 	user, _ := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
 
 	feed, err := s.db.GetFeedByUrl(context.Background(), cmd.args[0])
@@ -297,81 +356,351 @@ func handlerUnfollow(s *state, cmd command) error {
 	return nil
 }
 
-// Aggregation function to scrape feeds
-func scrapeFeeds(s* state) error {
-	feed, err := s.db.GetNextFeedToFetch(context.Background())
-	if err != nil {
-		return err
+// How long a claimed feed stays reserved for this process. Claims left behind
+// by a crashed process expire after this and are picked up by other workers.
+const feedClaimLease = 5 * time.Minute
+
+// Aggregation function to scrape feeds. Claims batches of the feeds that
+// were fetched least recently and fetches them with a pool of workers, until
+// every feed due at the start of the round has been fetched.
+// Claimed feeds are skipped by other agg processes sharing the database.
+func scrapeFeeds(s *state, client *http.Client, concurrency int) error {
+	roundStart := time.Now()
+	for {
+		feeds, err := s.db.ClaimNextFeedsToFetch(context.Background(), database.ClaimNextFeedsToFetchParams{
+			LeaseSeconds: int32(feedClaimLease.Seconds()),
+			FetchedBefore: roundStart,
+			BatchSize: int32(concurrency),
+		})
+		if err != nil {
+			return err
+		}
+		if len(feeds) == 0 {
+			return nil
+		}
+		err = fetchFeedBatch(s, client, feeds, concurrency)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Fetches a batch of claimed feeds with a pool of workers and releases the
+// claims
+func fetchFeedBatch(s *state, client *http.Client, feeds []database.Feed, concurrency int) error {
+	// Mark the feeds as fetched before handing them out
+	for _, feed := range feeds {
+		err := s.db.MarkFeedFetched(context.Background(), feed.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	jobs := make(chan database.Feed)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for feed := range jobs {
+				err := scrapeFeed(s, client, feed)
+				if err != nil {
+					fmt.Printf("Error scraping %s: %v\n", feed.Url, err)
+				}
+				err = s.db.ReleaseFeedClaim(context.Background(), feed.ID)
+				if err != nil {
+					fmt.Printf("Error releasing claim on %s: %v\n", feed.Url, err)
+				}
+			}
+		}()
+	}
+	for _, feed := range feeds {
+		jobs <- feed
+	}
+	close(jobs)
+	wg.Wait()
+	return nil
+}
+
+// Fetches a single feed and saves its posts to the database
+func scrapeFeed(s *state, client *http.Client, feed database.Feed) error {
+	fmt.Printf("Scraping %s...\n", feed.Url)
+	validators := &feedValidators{
+		ETag: feed.Etag.String,
+		LastModified: feed.LastModified.String,
+	}
+	feedData, err := fetchFeed(context.Background(), client, feed.Url, validators)
+	if errors.Is(err, errNotModified) {
+		fmt.Printf("Feed %s not modified\n", feed.Url)
+		return recordFeedSuccess(s, feed, validators.StatusCode)
 	}
-	// Mark the feed as fetched
-	err = s.db.MarkFeedFetched(context.Background(), feed.ID)
+	if err != nil {
+		return recordFeedFailure(s, feed, validators.StatusCode, err)
+	}
+	err = s.db.SetFeedCacheValidators(context.Background(), database.SetFeedCacheValidatorsParams{
+		ID: feed.ID,
+		Etag: sql.NullString{
+			String: validators.ETag,
+			Valid: validators.ETag != "",
+		},
+		LastModified: sql.NullString{
+			String: validators.LastModified,
+			Valid: validators.LastModified != "",
+		},
+	})
 	if err != nil {
 		return err
 	}
-	fmt.Printf("Scraping %s...\n", feed.Url)
-	feedData, err := fetchFeed(context.Background(), feed.Url)
+	err = recordFeedSuccess(s, feed, validators.StatusCode)
 	if err != nil {
 		return err
 	}
-	
+
 	// Save the feeds to the database
+	fetchedAt := time.Now().UTC()
 	for _, post := range(feedData.Channel.Item) {
-		publishedAt, err := parseTime(post.PubDate)
+		publishedAt, ok := itemPublishedAt(post)
+		if !ok {
+			fmt.Printf("No valid date for %q, using fetch time\n", post.Title)
+			publishedAt = fetchedAt
+		}
+		err := savePost(s, feed, post, publishedAt)
 		if err != nil {
-			return err
+			// Log the error but keep processing
+			fmt.Printf("Error saving post: %v\n", err)
 		}
+	}
+
+	return nil
+}
+
+// Returns a hash of the content of an item for detecting upstream edits
+func contentHash(item RSSItem) string {
+	sum := sha256.Sum256([]byte(item.Title + "\x00" + item.Link + "\x00" + item.Description))
+	return hex.EncodeToString(sum[:])
+}
+
+// Inserts a new post, or updates an existing one whose content has changed
+// upstream. The previous version of an edited post is kept as a revision.
+func savePost(s *state, feed database.Feed, item RSSItem, publishedAt time.Time) error {
+	guid := item.GUID
+	if guid == "" {
+		guid = item.Link
+	}
+	hash := contentHash(item)
+	description := sql.NullString{
+		String: item.Description,
+		Valid: item.Description != "",
+	}
+	existing, err := s.db.GetPostByGuid(context.Background(), database.GetPostByGuidParams{
+		FeedID: feed.ID,
+		Guid: guid,
+	})
+	// Posts saved before guids were stored have their URL as guid
+	if errors.Is(err, sql.ErrNoRows) && guid != item.Link {
+		existing, err = s.db.AdoptPostGuid(context.Background(), database.AdoptPostGuidParams{
+			FeedID: feed.ID,
+			Url: item.Link,
+			Guid: guid,
+		})
+	}
+	if errors.Is(err, sql.ErrNoRows) {
 		res, err := s.db.CreatePost(context.Background(), database.CreatePostParams{
 			ID: uuid.New(),
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
-			Title: post.Title,
-			Url: post.Link,
-			Description: sql.NullString{
-				String: post.Description,
-				Valid: post.Description != "",
-			},
+			Title: item.Title,
+			Url: item.Link,
+			Description: description,
 			PublishedAt: publishedAt,
 			FeedID: feed.ID,
+			Guid: guid,
+			ContentHash: hash,
 		})
+		// Another process saved the post first
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
 		if err != nil {
-			// Ignore errors from duplicate URLs
-			if strings.Contains(err.Error(), "UNIQUE constraint failed: posts.url") || strings.Contains(err.Error(), "duplicate key value violates unique constraint \"posts_url_key\"") {
-				continue
-			}
-			// Otherwise, log the error but keep processing
-			fmt.Printf("Error creating post: %v", err)
-			continue
+			return err
 		}
 		fmt.Printf("Saved feed with title %s\n", res.Title)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.ContentHash == hash {
+		return nil
+	}
+	// Posts saved before hashes were stored only get their hash filled in
+	if existing.ContentHash != "" {
+		err = s.db.CreatePostRevision(context.Background(), database.CreatePostRevisionParams{
+			ID: uuid.New(),
+			CreatedAt: time.Now(),
+			PostID: existing.ID,
+			Title: existing.Title,
+			Url: existing.Url,
+			Description: existing.Description,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	res, err := s.db.UpdatePostContent(context.Background(), database.UpdatePostContentParams{
+		ID: existing.ID,
+		Title: item.Title,
+		Url: item.Link,
+		Description: description,
+		ContentHash: hash,
+	})
+	if err != nil {
+		return err
+	}
+	if existing.ContentHash != "" {
+		fmt.Printf("Updated feed with title %s\n", res.Title)
 	}
-
 	return nil
 }
 
-func parseTime(timeStr string) (time.Time, error) {
-	timeFormats := []string {
-		time.RFC1123Z,
-		time.RFC1123,
-		time.RFC3339,
-		"2006-01-02 15:04:05",
-		"Mon Jan 2 15:04:05 -0700 MST 2006",
-	}
-	t := time.Time{}
-	for _, format := range timeFormats {
-		t, err := time.Parse(format, timeStr)
-		if err == nil {
-			return t, nil
+// Default for the number of consecutive failures after which a feed is disabled
+const defaultMaxFeedFailures = 10
+
+// Longest time agg waits before retrying a failing feed
+const maxFeedBackoff = 24 * time.Hour
+
+// Returns how long to wait before retrying a feed that has already failed
+// the given number of times in a row, doubling from one minute
+func feedBackoff(failures int32) time.Duration {
+	if failures > 20 {
+		return maxFeedBackoff
+	}
+	return min(time.Minute << failures, maxFeedBackoff)
+}
+
+func recordFeedSuccess(s *state, feed database.Feed, statusCode int) error {
+	return s.db.RecordFeedSuccess(context.Background(), database.RecordFeedSuccessParams{
+		ID: feed.ID,
+		LastHttpStatus: sql.NullInt32{
+			Int32: int32(statusCode),
+			Valid: statusCode != 0,
+		},
+	})
+}
+
+// Records a failed fetch, backing off the feed and disabling it after too
+// many consecutive failures. Returns the fetch error.
+func recordFeedFailure(s *state, feed database.Feed, statusCode int, fetchErr error) error {
+	maxFailures := s.cfg.MaxFeedFailures
+	if maxFailures <= 0 {
+		maxFailures = defaultMaxFeedFailures
+	}
+	res, err := s.db.RecordFeedFailure(context.Background(), database.RecordFeedFailureParams{
+		LastError: sql.NullString{
+			String: fetchErr.Error(),
+			Valid: true,
+		},
+		LastHttpStatus: sql.NullInt32{
+			Int32: int32(statusCode),
+			Valid: statusCode != 0,
+		},
+		BackoffSeconds: int32(feedBackoff(feed.ConsecutiveFailures).Seconds()),
+		MaxFailures: int32(maxFailures),
+		ID: feed.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("Error recording failure (%v): %w", fetchErr, err)
+	}
+	if res.Disabled {
+		fmt.Printf("Feed %s disabled after %d consecutive failures\n", feed.Url, res.ConsecutiveFailures)
+	}
+	return fetchErr
+}
+
+// Parses an optional time flag, accepting the same formats as feed dates
+func parseTimeFlag(name, value string) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := parseTime(value)
+	if err != nil {
+		return sql.NullTime{}, fmt.Errorf("Invalid time for --%s: %q", name, value)
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+// Filters and paging of a post listing, given as browse flags or as query
+// parameters of the posts API
+type browseOptions struct {
+	limit      int
+	unreadOnly bool
+	feed       string
+	since      string
+	until      string
+	sort       string
+	page       int
+	offset     int
+	after      string
+}
+
+// Returns the query parameters listing the user's posts with the given options
+func browseParams(s *state, userID uuid.UUID, opts browseOptions) (database.GetPostsForUserParams, error) {
+	if opts.sort != "asc" && opts.sort != "desc" {
+		return database.GetPostsForUserParams{}, errors.New("Sort order must be asc or desc")
+	}
+	if opts.page != 0 && opts.offset != 0 {
+		return database.GetPostsForUserParams{}, errors.New("Please pass only one of --page and --offset")
+	}
+	if opts.page < 0 || opts.offset < 0 {
+		return database.GetPostsForUserParams{}, errors.New("Page and offset must not be negative")
+	}
+	offset := opts.offset
+	if opts.page > 0 {
+		offset = (opts.page - 1) * opts.limit
+	}
+	if offset > math.MaxInt32 {
+		return database.GetPostsForUserParams{}, errors.New("Page or offset is too large")
+	}
+
+	params := database.GetPostsForUserParams{
+		UserID: userID,
+		UnreadOnly: opts.unreadOnly,
+		Feed: sql.NullString{
+			String: opts.feed,
+			Valid: opts.feed != "",
+		},
+		SortAsc: opts.sort == "asc",
+		Limit: int32(opts.limit),
+		Offset: int32(offset),
+	}
+	var err error
+	params.Since, err = parseTimeFlag("since", opts.since)
+	if err != nil {
+		return params, err
+	}
+	params.Until, err = parseTimeFlag("until", opts.until)
+	if err != nil {
+		return params, err
+	}
+	if opts.after != "" {
+		afterPost, err := getPostByArg(s, userID, opts.after)
+		if err != nil {
+			return params, err
 		}
+		params.AfterPublishedAt = sql.NullTime{Time: afterPost.PublishedAt, Valid: true}
+		params.AfterID = uuid.NullUUID{UUID: afterPost.ID, Valid: true}
 	}
-	return t, fmt.Errorf("Could not parse time: %s", timeStr)
+	return params, nil
 }
 
+// Prints the latest posts of the followed feeds. Only unread posts are shown
+// unless --all or --unread=false is given.
 func handlerBrowse(s *state, cmd command) error {
 	limit := 2
-	if len(cmd.args) >= 1 {
+	if len(cmd.args) == 1 {
 		num, err := strconv.Atoi(cmd.args[0])
-		if err != nil {
-			return errors.New("Argument is not a number")
+		if err != nil || num < 1 {
+			return usageError("Limit must be a positive number")
 		}
 		limit = num
 	}
@@ -379,63 +708,86 @@ func handlerBrowse(s *state, cmd command) error {
 	if err != nil {
 		return fmt.Errorf("Error getting user %q from database", s.cfg.CurrentUsername)
 	}
-	userId := user.ID
-	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{ UserID: userId, Limit: int32(limit) })
+	params, err := browseParams(s, user.ID, browseOptions{
+		limit: limit,
+		unreadOnly: cmd.boolFlag("unread") && !cmd.boolFlag("all"),
+		feed: cmd.stringFlag("feed"),
+		since: cmd.stringFlag("since"),
+		until: cmd.stringFlag("until"),
+		sort: cmd.stringFlag("sort"),
+		page: cmd.intFlag("page"),
+		offset: cmd.intFlag("offset"),
+		after: cmd.stringFlag("after"),
+	})
+	if err != nil {
+		return err
+	}
+	posts, err := s.db.GetPostsForUser(context.Background(), params)
 	if err != nil {
 		return fmt.Errorf("Error getting posts for user %q from database: %w", s.cfg.CurrentUsername, err)
 	}
-	fmt.Printf("Browsing %d posts for user %s:\n", limit, s.cfg.CurrentUsername)
-	for _, post := range posts {
-		description := "N/A"
-		if post.Description.Valid {
-			description = post.Description.String
+	return render(cmd, postOutputs(posts), func() {
+		fmt.Printf("Browsing %d posts for user %s:\n", limit, s.cfg.CurrentUsername)
+		for _, post := range posts {
+			description := "N/A"
+			if post.Description.Valid {
+				description = post.Description.String
+			}
+			readStr := "unread"
+			if post.Read {
+				readStr = "read"
+			}
+			if post.Starred {
+				readStr += ", starred"
+			}
+			fmt.Printf("ID: %s (%s)\nTitle: %s\nDescription: %s\nPublishedAt: %s\n", post.ID, readStr, post.Title, description, post.PublishedAt)
+			if post.Revisions > 0 {
+				fmt.Printf("Edited: %s (%d earlier versions)\n", post.UpdatedAt, post.Revisions)
+			}
+			fmt.Println()
 		}
-		fmt.Printf("Title: %s\nDescription: %s\nPublishedAt: %s\n\n", post.Title, description, post.PublishedAt)
-	}
-	return nil
+	})
 }
 
 func main() {
+	cmds := newCommands()
+
+	// Read user input
+	args := os.Args
+	if len(args) < 2 {
+		fmt.Print("No arguments provided.\n\n")
+		cmds.printHelp(os.Stdout)
+		os.Exit(1)
+	}
+	cmdName, cmdArgs, err := splitCommandLine(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		cmds.printHelp(os.Stdout)
+		return
+	}
+	if err != nil {
+		fmt.Print(err, "\n\n")
+		cmds.printHelp(os.Stdout)
+		os.Exit(1)
+	}
+
 	cfg, err := config.Read()
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 	s := &state{cfg: &cfg}
-	db, err := sql.Open("postgres", cfg.DbURL)
+	db, backend, err := openDatabase(cfg.DbURL)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	dbQueries := database.New(db)
-	s.db = dbQueries
-
-	// Initalize commands struct
-	cmds := commands{
-		commands: make(map[string]func(*state, command) error),
+	s.db = backend.querier(db)
+	s.conn = db
+	s.backend = backend
+	s.checkSchema = func() error {
+		return checkSchemaVersion(db, backend)
 	}
 
-	// Register commands
-	cmds.register("login", handlerLogin)
-	cmds.register("register", handlerRegister)
-	cmds.register("reset", handlerReset)
-	cmds.register("users", handlerUsers)
-	cmds.register("agg", handlerAgg)
-	cmds.register("addfeed", handlerAddfeed)
-	cmds.register("feeds", handlerFeeds)
-	cmds.register("follow", handlerFollow)
-	cmds.register("following", handlerFollowing)
-	cmds.register("unfollow", handlerUnfollow)
-	cmds.register("browse", handlerBrowse)
-
-	// Read user input
-	args := os.Args
-	if len(args) < 2 {
-		fmt.Print("No arguments provided.\nUsage:\n  gator <command> [args]\n")
-		os.Exit(1)
-	}
-	cmdName := args[1]
-	cmdArgs := args[2:]
 	cmd := command{name: cmdName, args: cmdArgs}
 	err = cmds.run(s, cmd)
 	if err != nil {
@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhiillos/gator/internal/config"
+	"github.com/mhiillos/gator/internal/database"
+	"github.com/mhiillos/gator/internal/database/memory"
+)
+
+const blogFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+  <title>Go blog</title>
+  <link>https://blog.example.com/</link>
+  <description>Posts about Go</description>
+  <item>
+    <title>Generics in Go</title>
+    <link>https://blog.example.com/generics</link>
+    <guid>go-generics</guid>
+    <pubDate>Mon, 02 Jan 2023 10:00:00 GMT</pubDate>
+    <description>How type parameters work</description>
+  </item>
+  <item>
+    <title>Error handling</title>
+    <link>https://blog.example.com/errors</link>
+    <guid>go-errors</guid>
+    <pubDate>Tue, 03 Jan 2023 10:00:00 GMT</pubDate>
+    <description>Wrapping errors with context</description>
+  </item>
+  <item>
+    <title>Fuzzing</title>
+    <link>https://blog.example.com/fuzzing</link>
+    <guid>go-fuzzing</guid>
+    <pubDate>Wed, 04 Jan 2023 10:00:00 GMT</pubDate>
+    <description>Finding bugs with generated inputs</description>
+  </item>
+</channel>
+</rss>`
+
+const newsFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+<channel>
+  <title>Release news</title>
+  <link>https://news.example.com/</link>
+  <description>Releases</description>
+  <item>
+    <title>Release notes</title>
+    <link>https://news.example.com/release</link>
+    <guid>release</guid>
+    <pubDate>Thu, 05 Jan 2023 10:00:00 GMT</pubDate>
+    <description>What changed in this release</description>
+  </item>
+</channel>
+</rss>`
+
+// Starts a server with the feeds /rss.xml and /news.xml, a web page at /
+// advertising /rss.xml, and a page at /multi.html advertising both feeds
+func newFeedServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rss.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		io.WriteString(w, blogFeed)
+	})
+	mux.HandleFunc("/news.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		io.WriteString(w, newsFeed)
+	})
+	mux.HandleFunc("/multi.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<html><head>
+<link rel="alternate" type="application/rss+xml" href="/news.xml">
+<link rel="alternate" type="application/rss+xml" href="/rss.xml">
+</head><body></body></html>`)
+	})
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		io.WriteString(w, `<html><head><title>Blog</title>
+<link rel="alternate" type="application/rss+xml" title="Go blog" href="/rss.xml">
+</head><body><p>Hello</p></body></html>`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// Returns a state on the in-memory store. The config file is written to a
+// temporary home directory.
+func newTestState(t *testing.T) *state {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	return &state{
+		db:  memory.New(),
+		cfg: &config.Config{},
+		// The in-memory store has no schema
+		checkSchema: func() error { return nil },
+	}
+}
+
+// Runs fn and returns what it printed to standard output
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.String()
+	}()
+	fnErr := fn()
+	os.Stdout = stdout
+	w.Close()
+	return <-done, fnErr
+}
+
+// Runs a command line like gator does and returns its output
+func runCommand(t *testing.T, s *state, args ...string) (string, error) {
+	t.Helper()
+	name, cmdArgs, err := splitCommandLine(args)
+	if err != nil {
+		t.Fatalf("Invalid command line %q: %v", args, err)
+	}
+	return captureStdout(t, func() error {
+		return newCommands().run(s, command{name: name, args: cmdArgs})
+	})
+}
+
+// Runs a command line that must succeed and returns its output
+func mustRun(t *testing.T, s *state, args ...string) string {
+	t.Helper()
+	out, err := runCommand(t, s, args...)
+	if err != nil {
+		t.Fatalf("gator %s failed: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return out
+}
+
+// Fetches the posts of all feeds like one round of agg
+func fetchFeeds(t *testing.T, s *state) {
+	t.Helper()
+	out, err := captureStdout(t, func() error {
+		return scrapeFeeds(s, documentClient, 10)
+	})
+	if err != nil {
+		t.Fatalf("scrapeFeeds failed: %v\n%s", err, out)
+	}
+}
+
+// Registers alice, adds the blog feed for her and fetches its posts
+func newBlogState(t *testing.T) (*state, *httptest.Server) {
+	t.Helper()
+	s := newTestState(t)
+	srv := newFeedServer(t)
+	mustRun(t, s, "register", "alice")
+	mustRun(t, s, "addfeed", "Go blog", srv.URL+"/rss.xml")
+	fetchFeeds(t, s)
+	return s, srv
+}
+
+// Returns the current user's post with the given title
+func postByTitle(t *testing.T, s *state, title string) database.Post {
+	t.Helper()
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{UserID: user.ID, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, post := range posts {
+		if post.Title == title {
+			return database.Post{ID: post.ID, Title: post.Title, Url: post.Url, PublishedAt: post.PublishedAt, FeedID: post.FeedID, FeverID: post.FeverID}
+		}
+	}
+	t.Fatalf("No post titled %q", title)
+	return database.Post{}
+}
+
+// Returns the titles of the posts printed by browse --output json
+func browseTitles(t *testing.T, s *state, args ...string) []string {
+	t.Helper()
+	out := mustRun(t, s, append([]string{"--output", "json", "browse"}, args...)...)
+	var posts []postOutput
+	if err := json.Unmarshal([]byte(out), &posts); err != nil {
+		t.Fatalf("Invalid browse output: %v\n%s", err, out)
+	}
+	titles := []string{}
+	for _, post := range posts {
+		titles = append(titles, post.Title)
+	}
+	return titles
+}
+
+func assertContains(t *testing.T, out string, want ...string) {
+	t.Helper()
+	for _, str := range want {
+		if !strings.Contains(out, str) {
+			t.Errorf("Output does not contain %q:\n%s", str, out)
+		}
+	}
+}
+
+func assertTitles(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Got posts %q, want %q", got, want)
+	}
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s := newTestState(t)
+	out := mustRun(t, s, "register", "alice")
+	assertContains(t, out, "User alice created")
+	if s.cfg.CurrentUsername != "alice" {
+		t.Errorf("Current user is %q after register, want alice", s.cfg.CurrentUsername)
+	}
+	if _, err := runCommand(t, s, "register", "alice"); err == nil {
+		t.Error("Registering a taken name succeeded")
+	}
+	mustRun(t, s, "register", "bob")
+
+	out = mustRun(t, s, "login", "alice")
+	assertContains(t, out, `User "alice" set.`)
+	cfg, err := config.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CurrentUsername != "alice" {
+		t.Errorf("Config file has user %q, want alice", cfg.CurrentUsername)
+	}
+	if _, err := runCommand(t, s, "login", "carol"); err == nil {
+		t.Error("Logging in as an unknown user succeeded")
+	}
+	if _, err := runCommand(t, s, "login"); err == nil {
+		t.Error("login without a user name succeeded")
+	}
+}
+
+func TestUsers(t *testing.T) {
+	s := newTestState(t)
+	mustRun(t, s, "register", "alice")
+	mustRun(t, s, "register", "bob")
+	mustRun(t, s, "login", "alice")
+
+	out := mustRun(t, s, "users")
+	assertContains(t, out, "* alice (current)\n", "* bob\n")
+
+	var users []userOutput
+	out = mustRun(t, s, "users", "--output", "json")
+	if err := json.Unmarshal([]byte(out), &users); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+	if len(users) != 2 {
+		t.Fatalf("Got %d users, want 2", len(users))
+	}
+	for _, user := range users {
+		if user.Current != (user.Name == "alice") {
+			t.Errorf("User %s has current %v", user.Name, user.Current)
+		}
+	}
+
+	mustRun(t, s, "reset")
+	out = mustRun(t, s, "users")
+	if out != "" {
+		t.Errorf("users printed %q after reset", out)
+	}
+}
+
+func TestAddfeedAndFeeds(t *testing.T) {
+	s := newTestState(t)
+	srv := newFeedServer(t)
+	mustRun(t, s, "register", "alice")
+
+	out := mustRun(t, s, "addfeed", "Go blog", srv.URL+"/")
+	assertContains(t, out, "Using feed "+srv.URL+"/rss.xml found from "+srv.URL+"/", "Feed created", "Feed follow created")
+	if _, err := runCommand(t, s, "addfeed", "Again", srv.URL+"/rss.xml"); err == nil {
+		t.Error("Adding the same feed twice succeeded")
+	}
+
+	out = mustRun(t, s, "addfeed", "News", srv.URL+"/multi.html")
+	assertContains(t, out, "advertises several feeds", "  - "+srv.URL+"/news.xml", "  - "+srv.URL+"/rss.xml", "Using feed "+srv.URL+"/news.xml")
+
+	out = mustRun(t, s, "feeds")
+	assertContains(t, out, "Name: Go blog, URL: "+srv.URL+"/rss.xml, CreatedBy: alice", "Health: OK, last success: never")
+
+	fetchFeeds(t, s)
+	var feeds []feedOutput
+	out = mustRun(t, s, "feeds", "--output", "json")
+	if err := json.Unmarshal([]byte(out), &feeds); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+	if len(feeds) != 2 {
+		t.Fatalf("Got %d feeds, want 2", len(feeds))
+	}
+	for _, feed := range feeds {
+		if feed.LastSuccessAt == nil || feed.ConsecutiveFailures != 0 || feed.CreatedBy != "alice" {
+			t.Errorf("Unexpected feed after fetching: %+v", feed)
+		}
+	}
+
+	if _, err := runCommand(t, s, "addfeed", "Missing", srv.URL+"/missing.xml"); err == nil {
+		t.Error("Adding a missing feed succeeded")
+	}
+}
+
+func TestFollowAndUnfollow(t *testing.T) {
+	s, srv := newBlogState(t)
+	feedURL := srv.URL + "/rss.xml"
+	mustRun(t, s, "register", "bob")
+
+	out := mustRun(t, s, "following")
+	assertContains(t, out, `User "bob" is following:`)
+	if strings.Contains(out, "Go blog") {
+		t.Errorf("bob follows a feed before following it:\n%s", out)
+	}
+
+	out = mustRun(t, s, "follow", feedURL)
+	assertContains(t, out, "bob started following feed Go blog")
+	out = mustRun(t, s, "following")
+	assertContains(t, out, "  - Go blog\n")
+	if _, err := runCommand(t, s, "follow", srv.URL+"/unknown.xml"); err == nil {
+		t.Error("Following an unknown feed succeeded")
+	}
+
+	assertTitles(t, browseTitles(t, s, "10"), "Fuzzing", "Error handling", "Generics in Go")
+
+	out = mustRun(t, s, "unfollow", feedURL)
+	assertContains(t, out, `User "bob" unfollowed "Go blog"`)
+	var follows []followOutput
+	out = mustRun(t, s, "following", "--output", "json")
+	if err := json.Unmarshal([]byte(out), &follows); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+	if len(follows) != 0 {
+		t.Errorf("bob still follows %+v", follows)
+	}
+	assertTitles(t, browseTitles(t, s, "10"))
+
+	// Unfollowing does not affect other users
+	mustRun(t, s, "login", "alice")
+	assertTitles(t, browseTitles(t, s, "1"), "Fuzzing")
+}
+
+func TestBrowse(t *testing.T) {
+	s, srv := newBlogState(t)
+	mustRun(t, s, "addfeed", "News", srv.URL+"/news.xml")
+	fetchFeeds(t, s)
+
+	out := mustRun(t, s, "browse")
+	assertContains(t, out, "Browsing 2 posts for user alice", "Title: Release notes", "Title: Fuzzing", "(unread)")
+
+	assertTitles(t, browseTitles(t, s, "10"), "Release notes", "Fuzzing", "Error handling", "Generics in Go")
+	assertTitles(t, browseTitles(t, s, "2", "--sort", "asc"), "Generics in Go", "Error handling")
+	assertTitles(t, browseTitles(t, s, "10", "--feed", "News"), "Release notes")
+	assertTitles(t, browseTitles(t, s, "10", "--feed", srv.URL+"/rss.xml"), "Fuzzing", "Error handling", "Generics in Go")
+	assertTitles(t, browseTitles(t, s, "10", "--since", "2023-01-03", "--until", "2023-01-05"), "Fuzzing", "Error handling")
+	assertTitles(t, browseTitles(t, s, "2", "--page", "2"), "Error handling", "Generics in Go")
+	assertTitles(t, browseTitles(t, s, "1", "--offset", "3"), "Generics in Go")
+
+	fuzzing := postByTitle(t, s, "Fuzzing")
+	assertTitles(t, browseTitles(t, s, "10", "--after", fuzzing.ID.String()), "Error handling", "Generics in Go")
+
+	mustRun(t, s, "read", fuzzing.ID.String())
+	assertTitles(t, browseTitles(t, s, "10"), "Release notes", "Error handling", "Generics in Go")
+	assertTitles(t, browseTitles(t, s, "2", "--all"), "Release notes", "Fuzzing")
+	assertTitles(t, browseTitles(t, s, "2", "--unread=false"), "Release notes", "Fuzzing")
+
+	for _, args := range [][]string{
+		{"browse", "many"},
+		{"browse", "0"},
+		{"browse", "-1"},
+		{"browse", "--", "-1"},
+		{"browse", "--sort", "up"},
+		{"browse", "--page", "1", "--offset", "2"},
+		{"browse", "--offset", "-1"},
+		{"browse", "--since", "someday"},
+		{"browse", "--after", "not-an-id"},
+		{"browse", "1", "2"},
+	} {
+		if _, err := runCommand(t, s, args...); err == nil {
+			t.Errorf("gator %s succeeded", strings.Join(args, " "))
+		}
+	}
+	_, err := runCommand(t, s, "browse", "0")
+	if err == nil || !strings.Contains(err.Error(), "Limit must be a positive number\nUsage: gator browse") {
+		t.Errorf("browse 0 returned %v", err)
+	}
+}
+
+func TestFetchUpdatesEditedPosts(t *testing.T) {
+	s, srv := newBlogState(t)
+	post := postByTitle(t, s, "Generics in Go")
+	feed, err := s.db.GetFeedByUrl(context.Background(), srv.URL+"/rss.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fetching the same content again changes nothing
+	fetchFeeds(t, s)
+	item := RSSItem{
+		Title:       "Generics in Go, revised",
+		Link:        post.Url,
+		Description: "How type parameters work",
+		GUID:        "go-generics",
+	}
+	out, err := captureStdout(t, func() error {
+		return savePost(s, feed, item, time.Now())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertContains(t, out, "Updated feed with title Generics in Go, revised")
+
+	var posts []postOutput
+	out = mustRun(t, s, "--output", "json", "browse", "10")
+	if err := json.Unmarshal([]byte(out), &posts); err != nil {
+		t.Fatalf("Invalid browse output: %v\n%s", err, out)
+	}
+	if len(posts) != 3 {
+		t.Fatalf("Got %d posts after an edit, want 3", len(posts))
+	}
+	for _, row := range posts {
+		wantRevisions := int64(0)
+		if row.ID == post.ID {
+			wantRevisions = 1
+		}
+		if row.Revisions != wantRevisions {
+			t.Errorf("Post %q has %d revisions, want %d", row.Title, row.Revisions, wantRevisions)
+		}
+	}
+	assertContains(t, mustRun(t, s, "browse", "10"), "Title: Generics in Go, revised", "(1 earlier versions)")
+}
+
+func TestFetchAdoptsBackfilledGuids(t *testing.T) {
+	s := newTestState(t)
+	srv := newFeedServer(t)
+	mustRun(t, s, "register", "alice")
+	mustRun(t, s, "addfeed", "Go blog", srv.URL+"/rss.xml")
+	user, _ := s.db.GetUser(context.Background(), "alice")
+	feed, err := s.db.GetFeedByUrl(context.Background(), srv.URL+"/rss.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A post saved before guids were stored has its URL as guid
+	old, err := s.db.CreatePost(context.Background(), database.CreatePostParams{
+		ID:          uuid.New(),
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		Title:       "Generics in Go",
+		Url:         "https://blog.example.com/generics",
+		PublishedAt: time.Now(),
+		FeedID:      feed.ID,
+		Guid:        "https://blog.example.com/generics",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustRun(t, s, "star", old.ID.String())
+	fetchFeeds(t, s)
+
+	posts, err := s.db.GetPostsForUser(context.Background(), database.GetPostsForUserParams{UserID: user.ID, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 3 {
+		t.Fatalf("Got %d posts, want 3 without duplicates", len(posts))
+	}
+	adopted, err := s.db.GetPostByGuid(context.Background(), database.GetPostByGuidParams{FeedID: feed.ID, Guid: "go-generics"})
+	if err != nil {
+		t.Fatalf("Post did not get its guid: %v", err)
+	}
+	if adopted.ID != old.ID {
+		t.Error("A new post was saved instead of adopting the old one")
+	}
+	starred, _ := s.db.GetStarredPostsForUser(context.Background(), user.ID)
+	if len(starred) != 1 || starred[0].ID != old.ID {
+		t.Errorf("Adopted post lost its star: %+v", starred)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/pressly/goose/v3"
+)
+
+// The goose migrations of each backend, built into the binary
+//
+//go:embed sql/schema/*.sql sql/sqlite/schema/*.sql
+var embeddedMigrations embed.FS
+
+// Returns a goose provider running the embedded migrations of the backend
+// against the database
+func newMigrationProvider(db *sql.DB, backend backend) (*goose.Provider, error) {
+	migrations, err := fs.Sub(embeddedMigrations, backend.migrations)
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(backend.dialect, db, migrations)
+}
+
+// Returns an error if the database schema does not match the migrations built
+// into the binary, so commands do not run against missing or unknown columns
+func checkSchemaVersion(db *sql.DB, backend backend) error {
+	provider, err := newMigrationProvider(db, backend)
+	if err != nil {
+		return fmt.Errorf("Error loading migrations: %w", err)
+	}
+	current, target, err := provider.GetVersions(context.Background())
+	if err != nil {
+		return fmt.Errorf("Error getting database schema version: %w", err)
+	}
+	if current < target {
+		return fmt.Errorf("Database schema is at version %d, but this version of gator requires version %d.\nRun \"gator migrate up\" to apply the pending migrations.", current, target)
+	}
+	if current > target {
+		return fmt.Errorf("Database schema is at version %d, which is newer than the version %d supported by this version of gator.\nPlease upgrade gator.", current, target)
+	}
+	return nil
+}
+
+// Applies or rolls back the embedded migrations, or prints their status
+func handlerMigrate(s *state, cmd command) error {
+	provider, err := newMigrationProvider(s.conn, s.backend)
+	if err != nil {
+		return fmt.Errorf("Error loading migrations: %w", err)
+	}
+	ctx := context.Background()
+	switch cmd.args[0] {
+	case "up":
+		results, err := provider.Up(ctx)
+		for _, result := range results {
+			fmt.Printf("Applied %s\n", path.Base(result.Source.Path))
+		}
+		if err != nil {
+			return fmt.Errorf("Error applying migrations: %w", err)
+		}
+		if len(results) == 0 {
+			fmt.Println("Database schema is up to date")
+		}
+	case "down":
+		result, err := provider.Down(ctx)
+		if errors.Is(err, goose.ErrNoNextVersion) {
+			fmt.Println("No migrations to roll back")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error rolling back migration: %w", err)
+		}
+		fmt.Printf("Rolled back %s\n", path.Base(result.Source.Path))
+	case "status":
+		statuses, err := provider.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("Error getting migration status: %w", err)
+		}
+		for _, status := range statuses {
+			appliedAt := "Pending"
+			if status.State == goose.StateApplied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-20s %s\n", appliedAt, path.Base(status.Source.Path))
+		}
+	default:
+		return fmt.Errorf("Unknown migrate action %q, use up, down or status", cmd.args[0])
+	}
+	return nil
+}
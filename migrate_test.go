@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mhiillos/gator/internal/config"
+)
+
+// Returns a state on an empty SQLite database, checking its schema like gator
+// does
+func newSQLiteState(t *testing.T) *state {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	db, backend, err := openDatabase("sqlite://" + filepath.Join(t.TempDir(), "gator.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &state{
+		db:      backend.querier(db),
+		conn:    db,
+		backend: backend,
+		cfg:     &config.Config{},
+		checkSchema: func() error {
+			return checkSchemaVersion(db, backend)
+		},
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	s := newSQLiteState(t)
+
+	// Commands refuse to run before the schema is created
+	_, err := runCommand(t, s, "users")
+	if err == nil || !strings.Contains(err.Error(), `Run "gator migrate up"`) {
+		t.Errorf("users on an empty database returned %v", err)
+	}
+	out := mustRun(t, s, "migrate", "status")
+	assertContains(t, out, "Pending              001_schema.sql", "Pending              003_fever.sql")
+
+	out = mustRun(t, s, "migrate", "up")
+	assertContains(t, out, "Applied 001_schema.sql", "Applied 002_api_keys.sql", "Applied 003_fever.sql")
+	assertContains(t, mustRun(t, s, "migrate", "up"), "Database schema is up to date")
+	if out := mustRun(t, s, "migrate", "status"); strings.Contains(out, "Pending") {
+		t.Errorf("Migrations are pending after migrate up:\n%s", out)
+	}
+	mustRun(t, s, "register", "alice")
+	assertContains(t, mustRun(t, s, "users"), "* alice (current)")
+
+	// Rolling back one migration leaves the schema outdated
+	assertContains(t, mustRun(t, s, "migrate", "down"), "Rolled back 003_fever.sql")
+	assertContains(t, mustRun(t, s, "migrate", "status"), "Pending              003_fever.sql")
+	_, err = runCommand(t, s, "users")
+	if err == nil || !strings.Contains(err.Error(), "Database schema is at version 2, but this version of gator requires version 3") {
+		t.Errorf("users on an outdated schema returned %v", err)
+	}
+	assertContains(t, mustRun(t, s, "help"), "Commands:")
+
+	mustRun(t, s, "migrate", "down")
+	mustRun(t, s, "migrate", "down")
+	assertContains(t, mustRun(t, s, "migrate", "down"), "No migrations to roll back")
+
+	_, err = runCommand(t, s, "migrate", "sideways")
+	if err == nil || !strings.Contains(err.Error(), `Unknown migrate action "sideways"`) {
+		t.Errorf("migrate sideways returned %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhiillos/gator/internal/database"
+)
+
+// For reading and writing OPML subscription lists
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    struct {
+		Title       string `xml:"title,omitempty"`
+		DateCreated string `xml:"dateCreated,omitempty"`
+	} `xml:"head"`
+	Body struct {
+		Outlines []OPMLOutline `xml:"outline"`
+	} `xml:"body"`
+}
+
+// An outline is either a feed (with xmlUrl) or a category holding other outlines
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// Returns the feed outlines of a document, including ones nested in categories
+func feedOutlines(outlines []OPMLOutline) []OPMLOutline {
+	feeds := []OPMLOutline{}
+	for _, outline := range outlines {
+		if outline.XMLURL != "" {
+			feeds = append(feeds, outline)
+		}
+		feeds = append(feeds, feedOutlines(outline.Outlines)...)
+	}
+	return feeds
+}
+
+// Imports the feeds of an OPML file and follows them for the current user
+func handlerImport(s *state, cmd command) error {
+	raw, err := os.ReadFile(cmd.args[0])
+	if err != nil {
+		return fmt.Errorf("Failed to read file %s", cmd.args[0])
+	}
+	doc := OPML{}
+	err = xml.Unmarshal(raw, &doc)
+	if err != nil {
+		return errors.New("Error unmarshaling OPML")
+	}
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		return fmt.Errorf("User %q not found", s.cfg.CurrentUsername)
+	}
+	feedFollows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("Error getting feed follows: %w", err)
+	}
+	following := map[uuid.UUID]bool{}
+	for _, feedFollow := range feedFollows {
+		following[feedFollow.FeedID] = true
+	}
+
+	added, skipped, failed := 0, 0, 0
+	for _, outline := range feedOutlines(doc.Body.Outlines) {
+		name := outline.Title
+		if name == "" {
+			name = outline.Text
+		}
+		if name == "" {
+			name = outline.XMLURL
+		}
+		feed, err := s.db.GetFeedByUrl(context.Background(), outline.XMLURL)
+		if errors.Is(err, sql.ErrNoRows) {
+			feed, err = s.db.CreateFeed(context.Background(), database.CreateFeedParams{
+				ID:        uuid.New(),
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+				Name:      name,
+				Url:       outline.XMLURL,
+				UserID:    user.ID,
+			})
+		}
+		if err != nil {
+			fmt.Printf("Failed: %s (%s): %v\n", name, outline.XMLURL, err)
+			failed++
+			continue
+		}
+		if following[feed.ID] {
+			fmt.Printf("Skipped: %s (%s)\n", name, outline.XMLURL)
+			skipped++
+			continue
+		}
+		_, err = s.db.CreateFeedFollow(context.Background(), database.CreateFeedFollowParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+			FeedID:    feed.ID,
+		})
+		if err != nil {
+			fmt.Printf("Failed: %s (%s): %v\n", name, outline.XMLURL, err)
+			failed++
+			continue
+		}
+		following[feed.ID] = true
+		fmt.Printf("Added: %s (%s)\n", name, outline.XMLURL)
+		added++
+	}
+	fmt.Printf("Import finished: %d added, %d skipped, %d failed\n", added, skipped, failed)
+	return nil
+}
+
+// Writes the current user's subscriptions as an OPML 2.0 document, to the
+// given file or to stdout
+func handlerExport(s *state, cmd command) error {
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		return fmt.Errorf("User %q not found", s.cfg.CurrentUsername)
+	}
+	feedFollows, err := s.db.GetFeedFollowsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("Error getting feed follows: %w", err)
+	}
+
+	doc := OPML{Version: "2.0"}
+	doc.Head.Title = fmt.Sprintf("gator subscriptions of %s", user.Name)
+	doc.Head.DateCreated = time.Now().Format(time.RFC1123Z)
+	for _, feedFollow := range feedFollows {
+		doc.Body.Outlines = append(doc.Body.Outlines, OPMLOutline{
+			Text:   feedFollow.FeedName,
+			Title:  feedFollow.FeedName,
+			Type:   "rss",
+			XMLURL: feedFollow.FeedUrl,
+		})
+	}
+	raw, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("Error marshaling OPML: %w", err)
+	}
+	raw = append([]byte(xml.Header), raw...)
+	raw = append(raw, '\n')
+
+	if len(cmd.args) == 0 {
+		_, err = os.Stdout.Write(raw)
+		return err
+	}
+	err = os.WriteFile(cmd.args[0], raw, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to write file %s", cmd.args[0])
+	}
+	fmt.Printf("Exported %d feeds to %s\n", len(feedFollows), cmd.args[0])
+	return nil
+}
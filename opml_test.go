@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestImport(t *testing.T) {
+	s, srv := newBlogState(t)
+	// The blog feed is already followed, news is new, and the podcast is
+	// nested in a category and has no title
+	path := writeTestFile(t, "subscriptions.opml", `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="Go blog" title="Go blog" type="rss" xmlUrl="`+srv.URL+`/rss.xml"/>
+    <outline text="News" type="rss" xmlUrl="`+srv.URL+`/news.xml" htmlUrl="https://news.example.com/"/>
+    <outline text="Audio">
+      <outline text="Podcast" type="rss" xmlUrl="https://podcast.example.com/feed.xml"/>
+    </outline>
+  </body>
+</opml>`)
+
+	out := mustRun(t, s, "import", path)
+	assertContains(t, out,
+		"Skipped: Go blog ("+srv.URL+"/rss.xml)",
+		"Added: News ("+srv.URL+"/news.xml)",
+		"Added: Podcast (https://podcast.example.com/feed.xml)",
+		"Import finished: 2 added, 1 skipped, 0 failed",
+	)
+	assertContains(t, mustRun(t, s, "following"), "  - Go blog\n", "  - News\n", "  - Podcast\n")
+
+	// Another user importing the same list follows the existing feeds
+	mustRun(t, s, "register", "bob")
+	out = mustRun(t, s, "import", path)
+	assertContains(t, out, "Import finished: 3 added, 0 skipped, 0 failed")
+	assertContains(t, mustRun(t, s, "feeds"), "URL: https://podcast.example.com/feed.xml, CreatedBy: alice")
+
+	if _, err := runCommand(t, s, "import", filepath.Join(t.TempDir(), "missing.opml")); err == nil {
+		t.Error("Importing a missing file succeeded")
+	}
+	if _, err := runCommand(t, s, "import", writeTestFile(t, "broken.opml", "<opml><body>")); err == nil {
+		t.Error("Importing an invalid file succeeded")
+	}
+}
+
+func TestExport(t *testing.T) {
+	s, srv := newBlogState(t)
+	mustRun(t, s, "addfeed", "News", srv.URL+"/news.xml")
+
+	out := mustRun(t, s, "export")
+	if !strings.HasPrefix(out, xml.Header) {
+		t.Errorf("Export does not start with an XML header:\n%s", out)
+	}
+	doc := OPML{}
+	if err := xml.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("Export is not valid OPML: %v\n%s", err, out)
+	}
+	if doc.Version != "2.0" || doc.Head.Title != "gator subscriptions of alice" || doc.Head.DateCreated == "" {
+		t.Errorf("Unexpected OPML head: version %q, %+v", doc.Version, doc.Head)
+	}
+	urls := []string{}
+	for _, outline := range doc.Body.Outlines {
+		urls = append(urls, outline.XMLURL)
+		if outline.Type != "rss" || outline.Text != outline.Title {
+			t.Errorf("Unexpected outline %+v", outline)
+		}
+	}
+	if len(urls) != 2 || !containsString(urls, srv.URL+"/rss.xml") || !containsString(urls, srv.URL+"/news.xml") {
+		t.Errorf("Exported feeds %q", urls)
+	}
+
+	// An exported file imports back into the same subscriptions
+	path := filepath.Join(t.TempDir(), "export.opml")
+	mustRun(t, s, "export", path)
+	mustRun(t, s, "register", "bob")
+	out = mustRun(t, s, "import", path)
+	assertContains(t, out, "Import finished: 2 added, 0 skipped, 0 failed")
+	assertContains(t, mustRun(t, s, "following"), "  - Go blog\n", "  - News\n")
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhiillos/gator/internal/database"
+)
+
+// Output formats accepted by the global --output flag
+var outputFormats = []string{"text", "json", "csv", "tsv"}
+
+// A user as listed by the users command
+type userOutput struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Current   bool      `json:"current"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// A feed as listed by the feeds command, including its fetch health
+type feedOutput struct {
+	ID                  uuid.UUID  `json:"id"`
+	Name                string     `json:"name"`
+	URL                 string     `json:"url"`
+	CreatedBy           string     `json:"created_by,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	LastFetchedAt       *time.Time `json:"last_fetched_at"`
+	LastSuccessAt       *time.Time `json:"last_success_at"`
+	LastHTTPStatus      *int32     `json:"last_http_status"`
+	LastError           *string    `json:"last_error"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	Disabled            bool       `json:"disabled"`
+}
+
+// A followed feed as listed by the following command
+type followOutput struct {
+	ID        uuid.UUID `json:"id"`
+	FeedID    uuid.UUID `json:"feed_id"`
+	FeedName  string    `json:"feed_name"`
+	FeedURL   string    `json:"feed_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// A post as listed by the browse and starred commands
+type postOutput struct {
+	ID          uuid.UUID  `json:"id"`
+	FeedID      uuid.UUID  `json:"feed_id"`
+	Title       string     `json:"title"`
+	URL         string     `json:"url"`
+	Description *string    `json:"description"`
+	PublishedAt time.Time  `json:"published_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	Read        bool       `json:"read"`
+	Starred     bool       `json:"starred"`
+	StarredAt   *time.Time `json:"starred_at"`
+	Revisions   int64      `json:"revisions"`
+}
+
+// A post as listed by the search command
+type searchResultOutput struct {
+	ID          uuid.UUID `json:"id"`
+	FeedName    string    `json:"feed_name"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+	Rank        float32   `json:"rank"`
+	Snippet     string    `json:"snippet"`
+}
+
+type apiKeyOutput struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	// Keys created before Fever support was added cannot sign in to Fever
+	Fever bool `json:"fever"`
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+func nullInt32Ptr(i sql.NullInt32) *int32 {
+	if !i.Valid {
+		return nil
+	}
+	return &i.Int32
+}
+
+func userOutputs(users []database.User, currentUser string) []userOutput {
+	records := []userOutput{}
+	for _, user := range users {
+		records = append(records, userOutput{
+			ID:        user.ID,
+			Name:      user.Name,
+			Current:   user.Name == currentUser,
+			CreatedAt: user.CreatedAt,
+			UpdatedAt: user.UpdatedAt,
+		})
+	}
+	return records
+}
+
+func feedOutputs(feeds []database.GetFeedsWithCreatorsRow) []feedOutput {
+	records := []feedOutput{}
+	for _, feed := range feeds {
+		records = append(records, feedOutput{
+			ID:                  feed.ID,
+			Name:                feed.Name,
+			URL:                 feed.Url,
+			CreatedBy:           feed.UserName,
+			CreatedAt:           feed.CreatedAt,
+			UpdatedAt:           feed.UpdatedAt,
+			LastFetchedAt:       nullTimePtr(feed.LastFetchedAt),
+			LastSuccessAt:       nullTimePtr(feed.LastSuccessAt),
+			LastHTTPStatus:      nullInt32Ptr(feed.LastHttpStatus),
+			LastError:           nullStringPtr(feed.LastError),
+			ConsecutiveFailures: feed.ConsecutiveFailures,
+			Disabled:            feed.Disabled,
+		})
+	}
+	return records
+}
+
+// Lists feeds without their creators, for showing feeds to a user without
+// revealing the names of other users
+func followedFeedOutputs(feeds []database.Feed) []feedOutput {
+	records := []feedOutput{}
+	for _, feed := range feeds {
+		records = append(records, feedOutput{
+			ID:                  feed.ID,
+			Name:                feed.Name,
+			URL:                 feed.Url,
+			CreatedAt:           feed.CreatedAt,
+			UpdatedAt:           feed.UpdatedAt,
+			LastFetchedAt:       nullTimePtr(feed.LastFetchedAt),
+			LastSuccessAt:       nullTimePtr(feed.LastSuccessAt),
+			LastHTTPStatus:      nullInt32Ptr(feed.LastHttpStatus),
+			LastError:           nullStringPtr(feed.LastError),
+			ConsecutiveFailures: feed.ConsecutiveFailures,
+			Disabled:            feed.Disabled,
+		})
+	}
+	return records
+}
+
+func followOutputs(follows []database.GetFeedFollowsForUserRow) []followOutput {
+	records := []followOutput{}
+	for _, follow := range follows {
+		records = append(records, followOutput{
+			ID:        follow.ID,
+			FeedID:    follow.FeedID,
+			FeedName:  follow.FeedName,
+			FeedURL:   follow.FeedUrl,
+			CreatedAt: follow.CreatedAt,
+		})
+	}
+	return records
+}
+
+func postOutputs(posts []database.GetPostsForUserRow) []postOutput {
+	records := []postOutput{}
+	for _, post := range posts {
+		records = append(records, postOutput{
+			ID:          post.ID,
+			FeedID:      post.FeedID,
+			Title:       post.Title,
+			URL:         post.Url,
+			Description: nullStringPtr(post.Description),
+			PublishedAt: post.PublishedAt,
+			CreatedAt:   post.CreatedAt,
+			UpdatedAt:   post.UpdatedAt,
+			Read:        post.Read,
+			Starred:     post.Starred,
+			Revisions:   post.Revisions,
+		})
+	}
+	return records
+}
+
+func starredPostOutputs(posts []database.GetStarredPostsForUserRow) []postOutput {
+	records := []postOutput{}
+	for _, post := range posts {
+		records = append(records, postOutput{
+			ID:          post.ID,
+			FeedID:      post.FeedID,
+			Title:       post.Title,
+			URL:         post.Url,
+			Description: nullStringPtr(post.Description),
+			PublishedAt: post.PublishedAt,
+			CreatedAt:   post.CreatedAt,
+			UpdatedAt:   post.UpdatedAt,
+			Read:        post.Read,
+			Starred:     true,
+			StarredAt:   nullTimePtr(post.StarredAt),
+		})
+	}
+	return records
+}
+
+func searchResultOutputs(posts []database.SearchPostsForUserRow) []searchResultOutput {
+	records := []searchResultOutput{}
+	for _, post := range posts {
+		records = append(records, searchResultOutput{
+			ID:          post.ID,
+			FeedName:    post.FeedName,
+			Title:       post.Title,
+			URL:         post.Url,
+			PublishedAt: post.PublishedAt,
+			Rank:        post.Rank,
+			Snippet:     post.Snippet,
+		})
+	}
+	return records
+}
+
+func apiKeyOutputs(keys []database.ApiKey) []apiKeyOutput {
+	records := []apiKeyOutput{}
+	for _, key := range keys {
+		records = append(records, apiKeyOutput{
+			ID:         key.ID,
+			Name:       key.Name,
+			Prefix:     key.Prefix,
+			CreatedAt:  key.CreatedAt,
+			LastUsedAt: nullTimePtr(key.LastUsedAt),
+			RevokedAt:  nullTimePtr(key.RevokedAt),
+			Fever:      key.FeverKeyHash.Valid,
+		})
+	}
+	return records
+}
+
+// Renders the records of a listing command in the format chosen with
+// --output. Records must be a slice of structs with json tags. The text
+// format, which is the default, is printed by the given function.
+func render(cmd command, records any, text func()) error {
+	switch cmd.stringFlag("output") {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case "csv":
+		return writeDelimited(os.Stdout, records, ',')
+	case "tsv":
+		return writeDelimited(os.Stdout, records, '\t')
+	default:
+		text()
+		return nil
+	}
+}
+
+// Writes records as delimited values with a header row named after the
+// json tags of the fields
+func writeDelimited(w io.Writer, records any, delimiter rune) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+	value := reflect.ValueOf(records)
+	recordType := value.Type().Elem()
+	header := []string{}
+	for i := range recordType.NumField() {
+		name, _, _ := strings.Cut(recordType.Field(i).Tag.Get("json"), ",")
+		header = append(header, name)
+	}
+	err := writer.Write(header)
+	if err != nil {
+		return err
+	}
+	for i := range value.Len() {
+		record := value.Index(i)
+		row := []string{}
+		for j := range record.NumField() {
+			row = append(row, formatField(record.Field(j)))
+		}
+		err = writer.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// Formats a field for delimited output. Missing values are left empty and
+// times use RFC 3339.
+func formatField(field reflect.Value) string {
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return ""
+		}
+		field = field.Elem()
+	}
+	if t, ok := field.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(field.Interface())
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// For reading Atom 1.0 data
+type AtomFeed struct {
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Link     []AtomLink  `xml:"link"`
+	Entry    []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Link      []AtomLink `xml:"link"`
+	Summary   AtomText   `xml:"summary"`
+	Content   AtomText   `xml:"content"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// Atom text constructs can hold plain text, escaped HTML or inline XHTML.
+// Inline XHTML is wrapped in a div that is not part of the content.
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+	Div   struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"http://www.w3.org/1999/xhtml div"`
+}
+
+// For reading RSS 1.0 (RDF Site Summary) data, where items sit outside the channel
+type RDFFeed struct {
+	Channel struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+	} `xml:"channel"`
+	Item []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About       string `xml:"about,attr"`
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	Description string `xml:"description"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+// For reading JSON Feed (https://jsonfeed.org/version/1.1) data
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	Description string         `json:"description"`
+	Items       []JSONFeedItem `json:"items"`
+}
+
+type JSONFeedItem struct {
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	ExternalURL   string `json:"external_url"`
+	Title         string `json:"title"`
+	ContentHTML   string `json:"content_html"`
+	ContentText   string `json:"content_text"`
+	Summary       string `json:"summary"`
+	DatePublished string `json:"date_published"`
+	DateModified  string `json:"date_modified"`
+}
+
+// Returns the text content, keeping the markup of inline XHTML
+func (t AtomText) String() string {
+	if t.Type == "xhtml" && t.Div.Inner != "" {
+		return strings.TrimSpace(t.Div.Inner)
+	}
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// Returns the alternate link, which is the default when rel is omitted
+func alternateLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) > 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+// Returns the local name of the root element of an XML document
+func rootElement(raw []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(raw))
+	decoder.Strict = false
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return "", errors.New("Document has no root element")
+		}
+		if err != nil {
+			return "", err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+// Reports whether the response looks like a JSON Feed rather than XML
+func isJSONFeed(raw []byte, contentType string) bool {
+	if strings.Contains(contentType, "application/feed+json") {
+		return true
+	}
+	trimmed := bytes.TrimSpace(raw)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		return false
+	}
+	var probe struct {
+		Version string `json:"version"`
+	}
+	err := json.Unmarshal(trimmed, &probe)
+	return err == nil && strings.HasPrefix(probe.Version, "https://jsonfeed.org/version/")
+}
+
+// Parses a feed document of any supported format into an RSSFeed
+func parseFeed(raw []byte, contentType string) (*RSSFeed, error) {
+	if isJSONFeed(raw, contentType) {
+		return parseJSONFeed(raw)
+	}
+	root, err := rootElement(raw)
+	if err != nil {
+		return nil, errors.New("Error unmarshaling XML")
+	}
+	switch root {
+	case "feed":
+		return parseAtom(raw)
+	case "RDF":
+		return parseRDF(raw)
+	case "html", "HTML":
+		return nil, errHTMLPage
+	default:
+		return parseRSS(raw)
+	}
+}
+
+func parseRSS(raw []byte) (*RSSFeed, error) {
+	rss := &RSSFeed{}
+	err := xml.Unmarshal(raw, rss)
+	if err != nil {
+		return nil, errors.New("Error unmarshaling XML")
+	}
+	return rss, nil
+}
+
+// Maps the entries of an Atom feed to RSS items
+func parseAtom(raw []byte) (*RSSFeed, error) {
+	atom := &AtomFeed{}
+	err := xml.Unmarshal(raw, atom)
+	if err != nil {
+		return nil, errors.New("Error unmarshaling Atom XML")
+	}
+	rss := &RSSFeed{}
+	rss.Channel.Title = atom.Title
+	rss.Channel.Link = alternateLink(atom.Link)
+	rss.Channel.Description = atom.Subtitle
+	for _, entry := range atom.Entry {
+		description := entry.Summary.String()
+		if description == "" {
+			description = entry.Content.String()
+		}
+		rss.Channel.Item = append(rss.Channel.Item, RSSItem{
+			Title:       entry.Title,
+			Link:        alternateLink(entry.Link),
+			Description: description,
+			GUID:        entry.ID,
+			PubDate:     entry.Published,
+			Updated:     entry.Updated,
+		})
+	}
+	return rss, nil
+}
+
+// Maps the items of an RSS 1.0 document to RSS items, using dc:date as the publish date
+func parseRDF(raw []byte) (*RSSFeed, error) {
+	rdf := &RDFFeed{}
+	err := xml.Unmarshal(raw, rdf)
+	if err != nil {
+		return nil, errors.New("Error unmarshaling RDF XML")
+	}
+	rss := &RSSFeed{}
+	rss.Channel.Title = rdf.Channel.Title
+	rss.Channel.Link = rdf.Channel.Link
+	rss.Channel.Description = rdf.Channel.Description
+	for _, item := range rdf.Item {
+		link := item.Link
+		if link == "" {
+			link = item.About
+		}
+		rss.Channel.Item = append(rss.Channel.Item, RSSItem{
+			Title:       item.Title,
+			Link:        link,
+			Description: item.Description,
+			GUID:        item.About,
+			DCDate:      item.Date,
+		})
+	}
+	return rss, nil
+}
+
+// Maps the items of a JSON Feed to RSS items
+func parseJSONFeed(raw []byte) (*RSSFeed, error) {
+	feed := &JSONFeed{}
+	err := json.Unmarshal(raw, feed)
+	if err != nil {
+		return nil, errors.New("Error unmarshaling JSON Feed")
+	}
+	rss := &RSSFeed{}
+	rss.Channel.Title = feed.Title
+	rss.Channel.Link = feed.HomePageURL
+	rss.Channel.Description = feed.Description
+	for _, item := range feed.Items {
+		// Items may only link to an external article, or carry a URL as their id
+		link := item.URL
+		if link == "" {
+			link = item.ExternalURL
+		}
+		if link == "" {
+			link = item.ID
+		}
+		description := item.ContentHTML
+		if description == "" {
+			description = item.Summary
+		}
+		if description == "" {
+			description = item.ContentText
+		}
+		rss.Channel.Item = append(rss.Channel.Item, RSSItem{
+			Title:       item.Title,
+			Link:        link,
+			Description: description,
+			GUID:        item.ID,
+			PubDate:     item.DatePublished,
+			Updated:     item.DateModified,
+		})
+	}
+	return rss, nil
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// An item expected from a parsed feed. published is empty when the item has
+// no usable date and is saved with the fetch time.
+type wantItem struct {
+	title       string
+	link        string
+	description string
+	guid        string
+	published   string
+}
+
+type parseTest struct {
+	name        string
+	contentType string
+	doc         string
+	title       string
+	link        string
+	items       []wantItem
+}
+
+func runParseTests(t *testing.T, tests []parseTest) {
+	t.Helper()
+	for _, tt := range tests {
+		feed, err := parseFeed([]byte(tt.doc), tt.contentType)
+		if err != nil {
+			t.Errorf("%s: parseFeed returned error: %v", tt.name, err)
+			continue
+		}
+		if feed.Channel.Title != tt.title || feed.Channel.Link != tt.link {
+			t.Errorf("%s: got channel %q at %q, want %q at %q", tt.name, feed.Channel.Title, feed.Channel.Link, tt.title, tt.link)
+		}
+		if len(feed.Channel.Item) != len(tt.items) {
+			t.Errorf("%s: got %d items, want %d", tt.name, len(feed.Channel.Item), len(tt.items))
+			continue
+		}
+		for i, want := range tt.items {
+			item := feed.Channel.Item[i]
+			if item.Title != want.title || item.Link != want.link || item.GUID != want.guid {
+				t.Errorf("%s: item %d is %q at %q with guid %q, want %q at %q with guid %q",
+					tt.name, i, item.Title, item.Link, item.GUID, want.title, want.link, want.guid)
+			}
+			if item.Description != want.description {
+				t.Errorf("%s: item %q has description %q, want %q", tt.name, want.title, item.Description, want.description)
+			}
+			published, ok := itemPublishedAt(item)
+			if ok != (want.published != "") {
+				t.Errorf("%s: item %q has a date %v, want %v", tt.name, want.title, ok, want.published != "")
+				continue
+			}
+			if ok && published.UTC().Format(time.RFC3339) != want.published {
+				t.Errorf("%s: item %q published at %s, want %s", tt.name, want.title, published.UTC().Format(time.RFC3339), want.published)
+			}
+		}
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	runParseTests(t, []parseTest{
+		{
+			name:        "RFC 4287 minimal feed",
+			contentType: "application/atom+xml",
+			doc: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example Feed</title>
+  <link href="http://example.org/"/>
+  <updated>2003-12-13T18:30:02Z</updated>
+  <author>
+    <name>John Doe</name>
+  </author>
+  <id>urn:uuid:60a76c80-d399-11d9-b93C-0003939e0af6</id>
+  <entry>
+    <title>Atom-Powered Robots Run Amok</title>
+    <link href="http://example.org/2003/12/13/atom03"/>
+    <id>urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a</id>
+    <updated>2003-12-13T18:30:02Z</updated>
+    <summary>Some text.</summary>
+  </entry>
+</feed>`,
+			title: "Example Feed",
+			link:  "http://example.org/",
+			items: []wantItem{
+				// Entries without published fall back to updated
+				{"Atom-Powered Robots Run Amok", "http://example.org/2003/12/13/atom03", "Some text.", "urn:uuid:1225c695-cfb8-4ebb-aaaa-80da344efa6a", "2003-12-13T18:30:02Z"},
+			},
+		},
+		{
+			name: "RFC 4287 extensive feed with XHTML content",
+			doc: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type="text">dive into mark</title>
+  <subtitle type="html">
+    A &lt;em&gt;lot&lt;/em&gt; of effort
+    went into making this effortless
+  </subtitle>
+  <updated>2005-07-31T12:29:29Z</updated>
+  <id>tag:example.org,2003:3</id>
+  <link rel="self" type="application/atom+xml" href="http://example.org/feed.atom"/>
+  <link rel="alternate" type="text/html" hreflang="en" href="http://example.org/"/>
+  <rights>Copyright (c) 2003, Mark Pilgrim</rights>
+  <generator uri="http://www.example.com/" version="1.0">Example Toolkit</generator>
+  <entry>
+    <title>Atom draft-07 snapshot</title>
+    <link rel="enclosure" type="audio/mpeg" length="1337" href="http://example.org/audio/ph34r_my_podcast.mp3"/>
+    <link rel="alternate" type="text/html" href="http://example.org/2005/04/02/atom"/>
+    <id>tag:example.org,2003:3.2397</id>
+    <updated>2005-07-31T12:29:29Z</updated>
+    <published>2003-12-13T08:29:29-04:00</published>
+    <author>
+      <name>Mark Pilgrim</name>
+      <uri>http://example.org/</uri>
+    </author>
+    <content type="xhtml" xml:lang="en" xml:base="http://diveintomark.org/">
+      <div xmlns="http://www.w3.org/1999/xhtml">
+        <p><i>[Update: The Atom draft is finished.]</i></p>
+      </div>
+    </content>
+  </entry>
+</feed>`,
+			title: "dive into mark",
+			link:  "http://example.org/",
+			items: []wantItem{
+				{"Atom draft-07 snapshot", "http://example.org/2005/04/02/atom", "<p><i>[Update: The Atom draft is finished.]</i></p>", "tag:example.org,2003:3.2397", "2003-12-13T12:29:29Z"},
+			},
+		},
+		{
+			name: "text, HTML and XHTML summaries",
+			doc: `<feed xmlns="http://www.w3.org/2005/Atom" xmlns:xhtml="http://www.w3.org/1999/xhtml">
+  <title>Mixed</title>
+  <link rel="alternate" href="https://mixed.example.com/"/>
+  <entry>
+    <title>Plain</title>
+    <link rel="alternate" href="https://mixed.example.com/plain"/>
+    <id>plain</id>
+    <published>2024-02-29T23:30:00+01:00</published>
+    <summary type="text">Tom &amp; Jerry</summary>
+  </entry>
+  <entry>
+    <title>Escaped</title>
+    <link rel="self" href="https://mixed.example.com/escaped.atom"/>
+    <link rel="alternate" href="https://mixed.example.com/escaped"/>
+    <id>escaped</id>
+    <published>2024-03-01T08:00:00Z</published>
+    <summary type="html">&lt;p&gt;Some &lt;b&gt;bold&lt;/b&gt; text&lt;/p&gt;</summary>
+  </entry>
+  <entry>
+    <title>Prefixed XHTML</title>
+    <link href="https://mixed.example.com/prefixed"/>
+    <id>prefixed</id>
+    <updated>2024-03-02T08:00:00Z</updated>
+    <content type="xhtml"><xhtml:div>Inline text</xhtml:div></content>
+  </entry>
+  <entry>
+    <title>Undated</title>
+    <link rel="related" href="https://other.example.com/"/>
+    <id>undated</id>
+    <content type="html">&lt;p&gt;No date&lt;/p&gt;</content>
+  </entry>
+</feed>`,
+			title: "Mixed",
+			link:  "https://mixed.example.com/",
+			items: []wantItem{
+				{"Plain", "https://mixed.example.com/plain", "Tom & Jerry", "plain", "2024-02-29T22:30:00Z"},
+				{"Escaped", "https://mixed.example.com/escaped", "<p>Some <b>bold</b> text</p>", "escaped", "2024-03-01T08:00:00Z"},
+				{"Prefixed XHTML", "https://mixed.example.com/prefixed", "Inline text", "prefixed", "2024-03-02T08:00:00Z"},
+				// Entries without an alternate link use their first link
+				{"Undated", "https://other.example.com/", "<p>No date</p>", "undated", ""},
+			},
+		},
+	})
+}
+
+func TestParseJSONFeed(t *testing.T) {
+	runParseTests(t, []parseTest{
+		{
+			name:        "JSON Feed 1.0",
+			contentType: "application/json",
+			doc: `{
+  "version": "https://jsonfeed.org/version/1",
+  "title": "My Example Feed",
+  "home_page_url": "https://example.org/",
+  "feed_url": "https://example.org/feed.json",
+  "author": {"name": "Brent Simmons"},
+  "items": [
+    {
+      "id": "2",
+      "content_text": "This is a second item.",
+      "url": "https://example.org/second-item",
+      "date_published": "2010-02-07T14:04:00-05:00"
+    },
+    {
+      "id": "1",
+      "title": "First item",
+      "content_html": "<p>Hello, world!</p>",
+      "summary": "A greeting",
+      "url": "https://example.org/initial-post",
+      "date_published": "2010-02-06T14:04:00-05:00"
+    }
+  ]
+}`,
+			title: "My Example Feed",
+			link:  "https://example.org/",
+			items: []wantItem{
+				{"", "https://example.org/second-item", "This is a second item.", "2", "2010-02-07T19:04:00Z"},
+				{"First item", "https://example.org/initial-post", "<p>Hello, world!</p>", "1", "2010-02-06T19:04:00Z"},
+			},
+		},
+		{
+			name:        "JSON Feed 1.1",
+			contentType: "application/feed+json; charset=utf-8",
+			doc: `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Linked list",
+  "home_page_url": "https://links.example.com/",
+  "authors": [{"name": "Jane"}],
+  "language": "en-US",
+  "items": [
+    {
+      "id": "https://links.example.com/2024/05/link",
+      "title": "A link",
+      "external_url": "https://elsewhere.example.com/article",
+      "summary": "Worth reading",
+      "date_published": "2024-05-01T09:00:00Z",
+      "date_modified": "2024-05-02T09:00:00Z"
+    },
+    {
+      "id": "https://links.example.com/2024/05/note",
+      "title": "A note",
+      "content_text": "Only an id",
+      "date_modified": "2024-05-03T10:15:00+02:00"
+    },
+    {
+      "id": "42",
+      "title": "Undated",
+      "url": "https://links.example.com/undated",
+      "content_html": "<p>No date</p>"
+    }
+  ]
+}`,
+			title: "Linked list",
+			link:  "https://links.example.com/",
+			items: []wantItem{
+				{"A link", "https://elsewhere.example.com/article", "Worth reading", "https://links.example.com/2024/05/link", "2024-05-01T09:00:00Z"},
+				// Items without date_published fall back to date_modified
+				{"A note", "https://links.example.com/2024/05/note", "Only an id", "https://links.example.com/2024/05/note", "2024-05-03T08:15:00Z"},
+				{"Undated", "https://links.example.com/undated", "<p>No date</p>", "42", ""},
+			},
+		},
+	})
+}
+
+func TestIsJSONFeed(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		contentType string
+		want        bool
+	}{
+		{"JSON Feed content type", `not even JSON`, "application/feed+json", true},
+		{"version 1", ` {"version": "https://jsonfeed.org/version/1", "items": []}`, "application/json", true},
+		{"version 1.1", `{"version": "https://jsonfeed.org/version/1.1"}`, "text/plain", true},
+		{"other JSON", `{"version": "1.0", "items": []}`, "application/json", false},
+		{"JSON without version", `{"title": "x"}`, "application/json", false},
+		{"invalid JSON", `{"version": "https://jsonfeed.org/version/1"`, "", false},
+		{"RSS", `<rss version="2.0"><channel></channel></rss>`, "application/rss+xml", false},
+	}
+	for _, tt := range tests {
+		if got := isJSONFeed([]byte(tt.raw), tt.contentType); got != tt.want {
+			t.Errorf("%s: isJSONFeed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseRDF(t *testing.T) {
+	runParseTests(t, []parseTest{
+		{
+			name:        "RSS 1.0 specification example",
+			contentType: "application/rdf+xml",
+			doc: `<?xml version="1.0"?>
+<rdf:RDF
+  xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+  xmlns:dc="http://purl.org/dc/elements/1.1/"
+  xmlns="http://purl.org/rss/1.0/">
+  <channel rdf:about="http://www.xml.com/xml/news.rss">
+    <title>XML.com</title>
+    <link>http://xml.com/pub</link>
+    <description>XML.com features a rich mix of information and services for the XML community.</description>
+    <image rdf:resource="http://xml.com/universal/images/xml_tiny.gif" />
+    <items>
+      <rdf:Seq>
+        <rdf:li resource="http://xml.com/pub/2000/08/09/xslt/xslt.html" />
+        <rdf:li resource="http://xml.com/pub/2000/08/09/rdfdb/index.html" />
+      </rdf:Seq>
+    </items>
+  </channel>
+  <image rdf:about="http://xml.com/universal/images/xml_tiny.gif">
+    <title>XML.com</title>
+    <link>http://www.xml.com</link>
+    <url>http://xml.com/universal/images/xml_tiny.gif</url>
+  </image>
+  <item rdf:about="http://xml.com/pub/2000/08/09/xslt/xslt.html">
+    <title>Processing Inclusions with XSLT</title>
+    <link>http://xml.com/pub/2000/08/09/xslt/xslt.html</link>
+    <description>Processing document inclusions with general XML tools can be problematic.</description>
+    <dc:date>2000-08-09T12:00:00+01:00</dc:date>
+  </item>
+  <item rdf:about="http://xml.com/pub/2000/08/09/rdfdb/index.html">
+    <title>Putting RDF to Work</title>
+    <link>http://xml.com/pub/2000/08/09/rdfdb/index.html</link>
+    <description>Tool and API support for the Resource Description Framework is slowly coming of age.</description>
+  </item>
+</rdf:RDF>`,
+			title: "XML.com",
+			link:  "http://xml.com/pub",
+			items: []wantItem{
+				{"Processing Inclusions with XSLT", "http://xml.com/pub/2000/08/09/xslt/xslt.html", "Processing document inclusions with general XML tools can be problematic.", "http://xml.com/pub/2000/08/09/xslt/xslt.html", "2000-08-09T11:00:00Z"},
+				{"Putting RDF to Work", "http://xml.com/pub/2000/08/09/rdfdb/index.html", "Tool and API support for the Resource Description Framework is slowly coming of age.", "http://xml.com/pub/2000/08/09/rdfdb/index.html", ""},
+			},
+		},
+		{
+			name: "RDF with W3C-DTF dates and items without links",
+			doc: `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns="http://purl.org/rss/1.0/">
+  <channel rdf:about="https://journal.example.jp/rss">
+    <title>Journal</title>
+    <link>https://journal.example.jp/</link>
+    <description>Daily notes</description>
+  </channel>
+  <item rdf:about="https://journal.example.jp/2024/01/15">
+    <title>Monday</title>
+    <dc:date>2024-01-15T21:05+09:00</dc:date>
+  </item>
+  <item rdf:about="https://journal.example.jp/2024/01/16">
+    <title>Tuesday</title>
+    <link>https://journal.example.jp/tuesday</link>
+    <dc:date>2024-01-16</dc:date>
+  </item>
+</rdf:RDF>`,
+			title: "Journal",
+			link:  "https://journal.example.jp/",
+			items: []wantItem{
+				// Items without a link use their rdf:about address
+				{"Monday", "https://journal.example.jp/2024/01/15", "", "https://journal.example.jp/2024/01/15", "2024-01-15T12:05:00Z"},
+				{"Tuesday", "https://journal.example.jp/tuesday", "", "https://journal.example.jp/2024/01/16", "2024-01-16T00:00:00Z"},
+			},
+		},
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/mhiillos/gator/internal/database"
+)
+
+// Looks up a post by the ID shown by browse. Only posts of the feeds the user
+// follows are found.
+func getPostByArg(s *state, userID uuid.UUID, arg string) (database.Post, error) {
+	id, err := uuid.Parse(arg)
+	if err != nil {
+		return database.Post{}, fmt.Errorf("%q is not a valid post ID", arg)
+	}
+	post, err := s.db.GetPostForUser(context.Background(), database.GetPostForUserParams{ID: id, UserID: userID})
+	if err != nil {
+		return database.Post{}, fmt.Errorf("Post %q not found", arg)
+	}
+	return post, nil
+}
+
+// Marks a post as read for the current user
+func handlerRead(s *state, cmd command) error {
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		return fmt.Errorf("User %q not found", s.cfg.CurrentUsername)
+	}
+	post, err := getPostByArg(s, user.ID, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	err = s.db.MarkPostRead(context.Background(), database.MarkPostReadParams{UserID: user.ID, PostID: post.ID})
+	if err != nil {
+		return fmt.Errorf("Error marking post as read: %w", err)
+	}
+	fmt.Printf("Marked %q as read\n", post.Title)
+	return nil
+}
+
+// Marks a post as unread for the current user
+func handlerUnread(s *state, cmd command) error {
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		return fmt.Errorf("User %q not found", s.cfg.CurrentUsername)
+	}
+	post, err := getPostByArg(s, user.ID, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	err = s.db.MarkPostUnread(context.Background(), database.MarkPostUnreadParams{UserID: user.ID, PostID: post.ID})
+	if err != nil {
+		return fmt.Errorf("Error marking post as unread: %w", err)
+	}
+	fmt.Printf("Marked %q as unread\n", post.Title)
+	return nil
+}
+
+// Marks all posts of the followed feeds, or of the feed with the given URL, as read
+func handlerMarkAllRead(s *state, cmd command) error {
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		return fmt.Errorf("User %q not found", s.cfg.CurrentUsername)
+	}
+	params := database.MarkAllPostsReadParams{UserID: user.ID}
+	if len(cmd.args) == 1 {
+		feed, err := s.db.GetFeedByUrl(context.Background(), cmd.args[0])
+		if err != nil {
+			return fmt.Errorf("Feed %q not found", cmd.args[0])
+		}
+		params.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+	}
+	count, err := s.db.MarkAllPostsRead(context.Background(), params)
+	if err != nil {
+		return fmt.Errorf("Error marking posts as read: %w", err)
+	}
+	fmt.Printf("Marked %d posts as read\n", count)
+	return nil
+}
+
+// Stars a post for the current user
+func handlerStar(s *state, cmd command) error {
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		return fmt.Errorf("User %q not found", s.cfg.CurrentUsername)
+	}
+	post, err := getPostByArg(s, user.ID, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	err = s.db.StarPost(context.Background(), database.StarPostParams{UserID: user.ID, PostID: post.ID})
+	if err != nil {
+		return fmt.Errorf("Error starring post: %w", err)
+	}
+	fmt.Printf("Starred %q\n", post.Title)
+	return nil
+}
+
+// Removes the star of a post for the current user
+func handlerUnstar(s *state, cmd command) error {
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		return fmt.Errorf("User %q not found", s.cfg.CurrentUsername)
+	}
+	post, err := getPostByArg(s, user.ID, cmd.args[0])
+	if err != nil {
+		return err
+	}
+	err = s.db.UnstarPost(context.Background(), database.UnstarPostParams{UserID: user.ID, PostID: post.ID})
+	if err != nil {
+		return fmt.Errorf("Error unstarring post: %w", err)
+	}
+	fmt.Printf("Unstarred %q\n", post.Title)
+	return nil
+}
+
+// Prints the posts the current user has starred, most recently starred first
+func handlerStarred(s *state, cmd command) error {
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		return fmt.Errorf("User %q not found", s.cfg.CurrentUsername)
+	}
+	posts, err := s.db.GetStarredPostsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("Error getting starred posts for user %q from database: %w", s.cfg.CurrentUsername, err)
+	}
+	return render(cmd, starredPostOutputs(posts), func() {
+		fmt.Printf("User %q has starred %d posts:\n", s.cfg.CurrentUsername, len(posts))
+		for _, post := range posts {
+			fmt.Printf("ID: %s\nTitle: %s\nURL: %s\nPublishedAt: %s\nStarredAt: %s\n\n", post.ID, post.Title, post.Url, post.PublishedAt, post.StarredAt.Time)
+		}
+	})
+}
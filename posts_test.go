@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReadAndUnread(t *testing.T) {
+	s, srv := newBlogState(t)
+	post := postByTitle(t, s, "Fuzzing")
+
+	out := mustRun(t, s, "read", post.ID.String())
+	assertContains(t, out, `Marked "Fuzzing" as read`)
+	assertTitles(t, browseTitles(t, s, "10"), "Error handling", "Generics in Go")
+	assertContains(t, mustRun(t, s, "browse", "1", "--all"), "(read)")
+
+	out = mustRun(t, s, "unread", post.ID.String())
+	assertContains(t, out, `Marked "Fuzzing" as unread`)
+	assertTitles(t, browseTitles(t, s, "10"), "Fuzzing", "Error handling", "Generics in Go")
+
+	// Read state is per user
+	mustRun(t, s, "read", post.ID.String())
+	mustRun(t, s, "register", "bob")
+	mustRun(t, s, "follow", srv.URL+"/rss.xml")
+	assertTitles(t, browseTitles(t, s, "1"), "Fuzzing")
+
+	for _, args := range [][]string{
+		{"read", "not-an-id"},
+		{"read", "00000000-0000-0000-0000-000000000000"},
+		{"unread", "not-an-id"},
+		{"read"},
+	} {
+		if _, err := runCommand(t, s, args...); err == nil {
+			t.Errorf("gator %s succeeded", strings.Join(args, " "))
+		}
+	}
+}
+
+func TestMarkAllRead(t *testing.T) {
+	s, srv := newBlogState(t)
+	mustRun(t, s, "addfeed", "News", srv.URL+"/news.xml")
+	fetchFeeds(t, s)
+	mustRun(t, s, "read", postByTitle(t, s, "Fuzzing").ID.String())
+
+	out := mustRun(t, s, "mark-all-read", srv.URL+"/rss.xml")
+	assertContains(t, out, "Marked 2 posts as read")
+	assertTitles(t, browseTitles(t, s, "10"), "Release notes")
+
+	out = mustRun(t, s, "mark-all-read")
+	assertContains(t, out, "Marked 1 posts as read")
+	assertTitles(t, browseTitles(t, s, "10"))
+
+	out = mustRun(t, s, "mark-all-read")
+	assertContains(t, out, "Marked 0 posts as read")
+	if _, err := runCommand(t, s, "mark-all-read", srv.URL+"/unknown.xml"); err == nil {
+		t.Error("Marking an unknown feed as read succeeded")
+	}
+}
+
+func TestStarAndUnstar(t *testing.T) {
+	s, _ := newBlogState(t)
+	generics := postByTitle(t, s, "Generics in Go")
+	fuzzing := postByTitle(t, s, "Fuzzing")
+
+	out := mustRun(t, s, "starred")
+	assertContains(t, out, `User "alice" has starred 0 posts:`)
+
+	assertContains(t, mustRun(t, s, "star", generics.ID.String()), `Starred "Generics in Go"`)
+	mustRun(t, s, "star", fuzzing.ID.String())
+	// Starring twice keeps a single star
+	mustRun(t, s, "star", fuzzing.ID.String())
+
+	out = mustRun(t, s, "starred")
+	assertContains(t, out, `User "alice" has starred 2 posts:`, "Title: Generics in Go", "Title: Fuzzing", "URL: https://blog.example.com/fuzzing")
+	assertContains(t, mustRun(t, s, "browse", "1"), "(unread, starred)")
+
+	var posts []postOutput
+	out = mustRun(t, s, "starred", "--output", "json")
+	if err := json.Unmarshal([]byte(out), &posts); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("Got %d starred posts, want 2", len(posts))
+	}
+	for _, post := range posts {
+		if !post.Starred || post.StarredAt == nil {
+			t.Errorf("Starred post %q has starred %v at %v", post.Title, post.Starred, post.StarredAt)
+		}
+	}
+
+	// Starring does not change the read state
+	mustRun(t, s, "read", generics.ID.String())
+	assertTitles(t, browseTitles(t, s, "10"), "Fuzzing", "Error handling")
+
+	assertContains(t, mustRun(t, s, "unstar", generics.ID.String()), `Unstarred "Generics in Go"`)
+	out = mustRun(t, s, "starred")
+	assertContains(t, out, "has starred 1 posts:", "Title: Fuzzing")
+	if strings.Contains(out, "Generics") {
+		t.Errorf("Unstarred post is still listed:\n%s", out)
+	}
+	assertTitles(t, browseTitles(t, s, "10"), "Fuzzing", "Error handling")
+
+	if _, err := runCommand(t, s, "star", "not-an-id"); err == nil {
+		t.Error("Starring an invalid ID succeeded")
+	}
+	if _, err := runCommand(t, s, "unstar", "00000000-0000-0000-0000-000000000000"); err == nil {
+		t.Error("Unstarring an unknown post succeeded")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	s, _ := newBlogState(t)
+
+	out := mustRun(t, s, "search", "errors")
+	assertContains(t, out, `Posts matching "errors":`, "Title: Error handling", "Feed: Go blog")
+	if strings.Contains(out, "Fuzzing") {
+		t.Errorf("Search matched an unrelated post:\n%s", out)
+	}
+
+	var results []searchResultOutput
+	out = mustRun(t, s, "--output", "json", "search", "generics", "-errors")
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+	if len(results) != 1 || results[0].Title != "Generics in Go" {
+		t.Errorf("Unexpected search results: %+v", results)
+	}
+
+	assertContains(t, mustRun(t, s, "search", "kubernetes"), `No posts match "kubernetes"`)
+}
+
+func TestPostsOfUnfollowedFeeds(t *testing.T) {
+	s, _ := newBlogState(t)
+	id := postByTitle(t, s, "Fuzzing").ID.String()
+	mustRun(t, s, "star", id)
+	mustRun(t, s, "register", "bob")
+
+	for _, args := range [][]string{
+		{"read", id},
+		{"unread", id},
+		{"star", id},
+		{"unstar", id},
+		{"browse", "--after", id},
+	} {
+		_, err := runCommand(t, s, args...)
+		if err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("gator %s returned %v", strings.Join(args, " "), err)
+		}
+	}
+	mustRun(t, s, "login", "alice")
+	assertTitles(t, browseTitles(t, s, "10", "--after", id), "Error handling", "Generics in Go")
+	assertContains(t, mustRun(t, s, "starred"), "Title: Fuzzing")
+}
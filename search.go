@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mhiillos/gator/internal/database"
+)
+
+// Number of results printed by the search command
+const searchLimit = 10
+
+// Searches the posts of the feeds the current user follows
+func handlerSearch(s *state, cmd command) error {
+	query := strings.Join(cmd.args, " ")
+	user, err := s.db.GetUser(context.Background(), s.cfg.CurrentUsername)
+	if err != nil {
+		return fmt.Errorf("User %q not found", s.cfg.CurrentUsername)
+	}
+	posts, err := s.db.SearchPostsForUser(context.Background(), database.SearchPostsForUserParams{
+		Query:  query,
+		UserID: user.ID,
+		Limit:  searchLimit,
+	})
+	if err != nil {
+		return fmt.Errorf("Error searching posts: %w", err)
+	}
+	return render(cmd, searchResultOutputs(posts), func() {
+		if len(posts) == 0 {
+			fmt.Printf("No posts match %q\n", query)
+			return
+		}
+		fmt.Printf("Posts matching %q:\n", query)
+		for _, post := range posts {
+			fmt.Printf("ID: %s\nTitle: %s\nFeed: %s\nURL: %s\nPublishedAt: %s\n%s\n\n", post.ID, post.Title, post.FeedName, post.Url, post.PublishedAt, post.Snippet)
+		}
+	})
+}
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mhiillos/gator/internal/database"
+)
+
+// How long the server waits for in-flight requests when shutting down
+const shutdownTimeout = 10 * time.Second
+
+// Number of posts the posts API returns when no limit is given
+const apiDefaultLimit = 20
+
+// Largest number of posts one API request can return
+const apiMaxLimit = 200
+
+// An API handler acting on behalf of the given user
+type apiHandler func(s *state, user database.User, w http.ResponseWriter, r *http.Request)
+
+// Serves the JSON API until interrupted, then waits for in-flight requests to
+// finish
+func handlerServe(s *state, cmd command) error {
+	client := newPublicDocumentClient()
+	if cmd.boolFlag("allow-private-feeds") {
+		client = documentClient
+	}
+	srv := &http.Server{
+		Addr:              cmd.stringFlag("addr"),
+		Handler:           logRequests(newAPIMux(s, client)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	log.Printf("Serving the API on %s", srv.Addr)
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("Error running server: %w", err)
+	case <-ctx.Done():
+	}
+	log.Printf("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("Error shutting down server: %w", err)
+	}
+	return nil
+}
+
+// Returns the routes of the JSON API and the Fever API. Feeds added through
+// the API are fetched with the given client.
+func newAPIMux(s *state, client *http.Client) *http.ServeMux {
+	mux := http.NewServeMux()
+	handle := func(pattern string, handler apiHandler) {
+		mux.HandleFunc(pattern, withAPIKey(s, handler))
+	}
+	handle("GET /api/user", apiGetUser)
+	handle("GET /api/feeds", apiGetFeeds)
+	handle("POST /api/feeds", apiCreateFeed(client))
+	handle("GET /api/follows", apiGetFollows)
+	handle("POST /api/follows", apiCreateFollow)
+	handle("DELETE /api/follows/{feedID}", apiDeleteFollow)
+	handle("GET /api/posts", apiGetPosts)
+	handle("GET /api/posts/starred", apiGetStarredPosts)
+	handle("GET /api/posts/search", apiSearchPosts)
+	handle("POST /api/posts/mark-all-read", apiMarkAllRead)
+	handle("PUT /api/posts/{postID}/read", apiMarkPostRead)
+	handle("DELETE /api/posts/{postID}/read", apiMarkPostUnread)
+	handle("PUT /api/posts/{postID}/star", apiStarPost)
+	handle("DELETE /api/posts/{postID}/star", apiUnstarPost)
+	// Fever clients sign in with their own api_key parameter
+	mux.HandleFunc("/fever", feverHandler(s))
+	mux.HandleFunc("/fever/", feverHandler(s))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		respondWithError(w, http.StatusNotFound, "Not found")
+	})
+	return mux
+}
+
+// Runs the handler as the owner of the API key given in the Authorization
+// header as "Bearer <key>"
+func withAPIKey(s *state, handler apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || key == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, http.StatusUnauthorized, "Missing API key")
+			return
+		}
+		keyHash := hashAPIKey(strings.TrimSpace(key))
+		user, err := s.db.GetUserByAPIKey(r.Context(), keyHash)
+		if errors.Is(err, sql.ErrNoRows) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			respondWithError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error checking API key: %v", err))
+			return
+		}
+		if err := s.db.MarkAPIKeyUsed(r.Context(), keyHash); err != nil {
+			log.Printf("Error recording API key use: %v", err)
+		}
+		handler(s, user, w, r)
+	}
+}
+
+// Records the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Logs the method, path, status and duration of every request
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		log.Printf("%s %s %d %s", r.Method, r.URL.RequestURI(), rec.status, time.Since(start).Round(time.Microsecond))
+	})
+}
+
+func respondWithJSON(w http.ResponseWriter, status int, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding response: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func respondWithError(w http.ResponseWriter, status int, msg string) {
+	if status >= 500 {
+		log.Println(msg)
+	}
+	respondWithJSON(w, status, map[string]string{"error": msg})
+}
+
+// Decodes the JSON request body into v, rejecting unknown fields
+func decodeBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("Invalid request body: %v", err)
+	}
+	return nil
+}
+
+// Returns the post named by the postID path parameter, if it belongs to a
+// feed the user follows
+func pathPost(s *state, user database.User, r *http.Request) (database.Post, int, error) {
+	id, err := uuid.Parse(r.PathValue("postID"))
+	if err != nil {
+		return database.Post{}, http.StatusBadRequest, fmt.Errorf("%q is not a valid post ID", r.PathValue("postID"))
+	}
+	post, err := s.db.GetPostForUser(r.Context(), database.GetPostForUserParams{ID: id, UserID: user.ID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Post{}, http.StatusNotFound, fmt.Errorf("Post %q not found", id)
+	}
+	if err != nil {
+		return database.Post{}, http.StatusInternalServerError, fmt.Errorf("Error getting post: %v", err)
+	}
+	return post, http.StatusOK, nil
+}
+
+// Returns the limit query parameter, or def if it is not given
+func queryLimit(r *http.Request, def int) (int, error) {
+	limit, err := queryInt(r, "limit", def)
+	if err != nil {
+		return 0, err
+	}
+	if limit < 1 || limit > apiMaxLimit {
+		return 0, fmt.Errorf("Query parameter limit must be between 1 and %d", apiMaxLimit)
+	}
+	return limit, nil
+}
+
+// Returns the integer query parameter, or def if it is not given
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	num, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Query parameter %s is not a number", name)
+	}
+	return num, nil
+}
+
+// Returns the owner of the API key
+func apiGetUser(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, userOutputs([]database.User{user}, user.Name)[0])
+}
+
+// Lists the feeds the user follows with their fetch health
+func apiGetFeeds(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+	feeds, err := s.db.GetFollowedFeeds(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error getting feeds: %v", err))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, followedFeedOutputs(feeds))
+}
+
+// Returns an API handler that adds a feed and follows it, like the addfeed
+// command. Web pages are searched for their feed with the given client, and
+// the feeds a page advertises are returned so the caller can pick another.
+func apiCreateFeed(client *http.Client) apiHandler {
+	return func(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name string `json:"name"`
+			URL  string `json:"url"`
+		}
+		if err := decodeBody(r, &body); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if body.Name == "" || body.URL == "" {
+			respondWithError(w, http.StatusBadRequest, "Both name and url are required")
+			return
+		}
+		url, advertised, err := discoverFeedURL(r.Context(), client, body.URL)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		feed, err := s.db.CreateFeed(r.Context(), database.CreateFeedParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			Name:      body.Name,
+			Url:       url,
+			UserID:    user.ID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusConflict, fmt.Sprintf("Error creating feed: %v", err))
+			return
+		}
+		follow, err := s.db.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+			ID:        uuid.New(),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+			UserID:    user.ID,
+			FeedID:    feed.ID,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error creating feed follow: %v", err))
+			return
+		}
+		resp := struct {
+			followOutput
+			AdvertisedFeeds []string `json:"advertised_feeds,omitempty"`
+		}{
+			followOutput: followOutput{
+				ID:        follow.ID,
+				FeedID:    feed.ID,
+				FeedName:  feed.Name,
+				FeedURL:   feed.Url,
+				CreatedAt: follow.CreatedAt,
+			},
+		}
+		if len(advertised) > 1 {
+			resp.AdvertisedFeeds = advertised
+		}
+		respondWithJSON(w, http.StatusCreated, resp)
+	}
+}
+
+func apiGetFollows(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+	follows, err := s.db.GetFeedFollowsForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error getting follows: %v", err))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, followOutputs(follows))
+}
+
+// Follows an existing feed given by its URL
+func apiCreateFollow(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		FeedURL string `json:"feed_url"`
+	}
+	if err := decodeBody(r, &body); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	feed, err := s.db.GetFeedByUrl(r.Context(), body.FeedURL)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("Feed %q not found", body.FeedURL))
+		return
+	}
+	follow, err := s.db.CreateFeedFollow(r.Context(), database.CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		UserID:    user.ID,
+		FeedID:    feed.ID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Error creating feed follow: %v", err))
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, followOutput{
+		ID:        follow.ID,
+		FeedID:    feed.ID,
+		FeedName:  follow.FeedName,
+		FeedURL:   feed.Url,
+		CreatedAt: follow.CreatedAt,
+	})
+}
+
+func apiDeleteFollow(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+	feedID, err := uuid.Parse(r.PathValue("feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%q is not a valid feed ID", r.PathValue("feedID")))
+		return
+	}
+	err = s.db.DeleteFeedFollow(r.Context(), database.DeleteFeedFollowParams{UserID: user.ID, FeedID: feedID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Removing follow failed: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists posts with the same filters as the browse command, given as query
+// parameters
+func apiGetPosts(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := browseOptions{
+		unreadOnly: query.Get("unread") != "false" && query.Get("all") != "true",
+		feed:       query.Get("feed"),
+		since:      query.Get("since"),
+		until:      query.Get("until"),
+		sort:       query.Get("sort"),
+		after:      query.Get("after"),
+	}
+	if opts.sort == "" {
+		opts.sort = "desc"
+	}
+	var err error
+	if opts.limit, err = queryLimit(r, apiDefaultLimit); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if opts.page, err = queryInt(r, "page", 0); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if opts.offset, err = queryInt(r, "offset", 0); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	params, err := browseParams(s, user.ID, opts)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	posts, err := s.db.GetPostsForUser(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error getting posts: %v", err))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, postOutputs(posts))
+}
+
+func apiGetStarredPosts(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+	posts, err := s.db.GetStarredPostsForUser(r.Context(), user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error getting starred posts: %v", err))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, starredPostOutputs(posts))
+}
+
+func apiSearchPosts(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		respondWithError(w, http.StatusBadRequest, "Query parameter q is required")
+		return
+	}
+	limit, err := queryLimit(r, searchLimit)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	posts, err := s.db.SearchPostsForUser(r.Context(), database.SearchPostsForUserParams{
+		Query:  query,
+		UserID: user.ID,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error searching posts: %v", err))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, searchResultOutputs(posts))
+}
+
+// Marks all posts of the followed feeds, or only of the feed_id query
+// parameter, as read
+func apiMarkAllRead(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+	params := database.MarkAllPostsReadParams{UserID: user.ID}
+	if value := r.URL.Query().Get("feed_id"); value != "" {
+		feedID, err := uuid.Parse(value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%q is not a valid feed ID", value))
+			return
+		}
+		params.FeedID = uuid.NullUUID{UUID: feedID, Valid: true}
+	}
+	count, err := s.db.MarkAllPostsRead(r.Context(), params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error marking posts as read: %v", err))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]int64{"marked": count})
+}
+
+// Returns an API handler that applies update to the post in the path
+func postStateHandler(update func(ctx context.Context, s *state, userID, postID uuid.UUID) error) apiHandler {
+	return func(s *state, user database.User, w http.ResponseWriter, r *http.Request) {
+		post, status, err := pathPost(s, user, r)
+		if err != nil {
+			respondWithError(w, status, err.Error())
+			return
+		}
+		if err := update(r.Context(), s, user.ID, post.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Error updating post state: %v", err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+var apiMarkPostRead = postStateHandler(func(ctx context.Context, s *state, userID, postID uuid.UUID) error {
+	return s.db.MarkPostRead(ctx, database.MarkPostReadParams{UserID: userID, PostID: postID})
+})
+
+var apiMarkPostUnread = postStateHandler(func(ctx context.Context, s *state, userID, postID uuid.UUID) error {
+	return s.db.MarkPostUnread(ctx, database.MarkPostUnreadParams{UserID: userID, PostID: postID})
+})
+
+var apiStarPost = postStateHandler(func(ctx context.Context, s *state, userID, postID uuid.UUID) error {
+	return s.db.StarPost(ctx, database.StarPostParams{UserID: userID, PostID: postID})
+})
+
+var apiUnstarPost = postStateHandler(func(ctx context.Context, s *state, userID, postID uuid.UUID) error {
+	return s.db.UnstarPost(ctx, database.UnstarPostParams{UserID: userID, PostID: postID})
+})
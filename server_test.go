@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Returns the blog state with an API key for alice and the API routes.
+// Feeds are added with the client used by the CLI, since the test feed
+// server listens on a loopback address.
+func newAPITest(t *testing.T) (*state, *httptest.Server, string, http.Handler) {
+	t.Helper()
+	s, srv := newBlogState(t)
+	key := createAPIKey(t, s, "test")
+	return s, srv, key, newAPIMux(s, documentClient)
+}
+
+// Sends a request to the API and returns the response
+func apiRequest(t *testing.T, h http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// Sends a request that must respond with the given status and decodes the
+// JSON response into v, unless v is nil
+func apiCall(t *testing.T, h http.Handler, method, path, key, body string, status int, v any) {
+	t.Helper()
+	rec := apiRequest(t, h, method, path, key, body)
+	if rec.Code != status {
+		t.Fatalf("%s %s returned %d, want %d: %s", method, path, rec.Code, status, rec.Body.String())
+	}
+	if v == nil {
+		return
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("%s %s returned invalid JSON: %v\n%s", method, path, err, rec.Body.String())
+	}
+}
+
+// Checks that the request fails with the given status and a JSON error
+func assertAPIError(t *testing.T, h http.Handler, method, path, key, body string, status int) {
+	t.Helper()
+	var resp struct {
+		Error string `json:"error"`
+	}
+	apiCall(t, h, method, path, key, body, status, &resp)
+	if resp.Error == "" {
+		t.Errorf("%s %s returned no error message", method, path)
+	}
+}
+
+func TestAPIAuthentication(t *testing.T) {
+	s, _, key, h := newAPITest(t)
+
+	rec := apiRequest(t, h, "GET", "/api/feeds", "", "")
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("Request without a key returned %d with WWW-Authenticate %q", rec.Code, rec.Header().Get("WWW-Authenticate"))
+	}
+	assertAPIError(t, h, "GET", "/api/feeds", "gator_wrong", "", http.StatusUnauthorized)
+	req := httptest.NewRequest("GET", "/api/feeds", nil)
+	req.Header.Set("Authorization", "Basic "+key)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Request with a Basic key returned %d", rec.Code)
+	}
+
+	apiCall(t, h, "GET", "/api/feeds", key, "", http.StatusOK, nil)
+	keys := listAPIKeys(t, s)
+	if len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Errorf("Key use was not recorded: %+v", keys)
+	}
+
+	mustRun(t, s, "apikey", "revoke", keys[0].ID.String())
+	assertAPIError(t, h, "GET", "/api/feeds", key, "", http.StatusUnauthorized)
+
+	assertAPIError(t, h, "GET", "/api/unknown", key, "", http.StatusNotFound)
+}
+
+func TestAPIUser(t *testing.T) {
+	s, _, key, h := newAPITest(t)
+	mustRun(t, s, "register", "bob")
+
+	var user userOutput
+	apiCall(t, h, "GET", "/api/user", key, "", http.StatusOK, &user)
+	if user.Name != "alice" || !user.Current {
+		t.Errorf("Got user %+v, want alice", user)
+	}
+	// Other users are not listed
+	assertAPIError(t, h, "GET", "/api/users", key, "", http.StatusNotFound)
+}
+
+func TestAPIFeeds(t *testing.T) {
+	s, srv, key, h := newAPITest(t)
+
+	// Only followed feeds are listed, without the names of their creators
+	mustRun(t, s, "register", "bob")
+	mustRun(t, s, "addfeed", "Bob's news", newFeedServer(t).URL+"/news.xml")
+	mustRun(t, s, "login", "alice")
+	rec := apiRequest(t, h, "GET", "/api/feeds", key, "")
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "created_by") || strings.Contains(rec.Body.String(), "bob") {
+		t.Errorf("Listing feeds returned %d: %s", rec.Code, rec.Body.String())
+	}
+	var feeds []feedOutput
+	apiCall(t, h, "GET", "/api/feeds", key, "", http.StatusOK, &feeds)
+	if len(feeds) != 1 || feeds[0].Name != "Go blog" || feeds[0].URL != srv.URL+"/rss.xml" {
+		t.Errorf("Unexpected feeds %+v", feeds)
+	}
+
+	var created struct {
+		followOutput
+		AdvertisedFeeds []string `json:"advertised_feeds"`
+	}
+	apiCall(t, h, "POST", "/api/feeds", key, `{"name": "News", "url": "`+srv.URL+`/multi.html"}`, http.StatusCreated, &created)
+	if created.FeedName != "News" || created.FeedURL != srv.URL+"/news.xml" {
+		t.Errorf("Unexpected feed %+v", created)
+	}
+	if len(created.AdvertisedFeeds) != 2 {
+		t.Errorf("Got advertised feeds %q, want both feeds", created.AdvertisedFeeds)
+	}
+	var follows []followOutput
+	apiCall(t, h, "GET", "/api/follows", key, "", http.StatusOK, &follows)
+	if len(follows) != 2 {
+		t.Errorf("Adding a feed did not follow it: %+v", follows)
+	}
+
+	assertAPIError(t, h, "POST", "/api/feeds", key, `{"name": "Again", "url": "`+srv.URL+`/rss.xml"}`, http.StatusConflict)
+	assertAPIError(t, h, "POST", "/api/feeds", key, `{"name": "", "url": "`+srv.URL+`/rss.xml"}`, http.StatusBadRequest)
+	assertAPIError(t, h, "POST", "/api/feeds", key, `{"name": "x", "url": "`+srv.URL+`/rss.xml", "extra": 1}`, http.StatusBadRequest)
+	assertAPIError(t, h, "POST", "/api/feeds", key, `{"name": "x",`, http.StatusBadRequest)
+	assertAPIError(t, h, "POST", "/api/feeds", key, `{"name": "x", "url": "`+srv.URL+`/missing"}`, http.StatusBadRequest)
+
+	// By default the server does not fetch from its own network
+	public := newAPIMux(s, newPublicDocumentClient())
+	mustRun(t, s, "unfollow", srv.URL+"/news.xml")
+	rec = apiRequest(t, public, "POST", "/api/feeds", key, `{"name": "Local", "url": "`+srv.URL+`/"}`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "non-public address") {
+		t.Errorf("Fetching a loopback address returned %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPIFollows(t *testing.T) {
+	s, srv, _, h := newAPITest(t)
+	mustRun(t, s, "register", "bob")
+	key := createAPIKey(t, s, "bob")
+
+	var follows []followOutput
+	apiCall(t, h, "GET", "/api/follows", key, "", http.StatusOK, &follows)
+	if len(follows) != 0 {
+		t.Errorf("bob follows %+v before following anything", follows)
+	}
+
+	var follow followOutput
+	apiCall(t, h, "POST", "/api/follows", key, `{"feed_url": "`+srv.URL+`/rss.xml"}`, http.StatusCreated, &follow)
+	if follow.FeedName != "Go blog" || follow.FeedURL != srv.URL+"/rss.xml" {
+		t.Errorf("Unexpected follow %+v", follow)
+	}
+	apiCall(t, h, "GET", "/api/follows", key, "", http.StatusOK, &follows)
+	if len(follows) != 1 || follows[0].FeedID != follow.FeedID {
+		t.Errorf("Unexpected follows %+v", follows)
+	}
+	assertAPIError(t, h, "POST", "/api/follows", key, `{"feed_url": "`+srv.URL+`/unknown.xml"}`, http.StatusNotFound)
+	assertAPIError(t, h, "POST", "/api/follows", key, `{"url": "x"}`, http.StatusBadRequest)
+
+	apiCall(t, h, "DELETE", "/api/follows/"+follow.FeedID.String(), key, "", http.StatusNoContent, nil)
+	apiCall(t, h, "GET", "/api/follows", key, "", http.StatusOK, &follows)
+	if len(follows) != 0 {
+		t.Errorf("bob still follows %+v", follows)
+	}
+	assertAPIError(t, h, "DELETE", "/api/follows/not-an-id", key, "", http.StatusBadRequest)
+
+	// alice still follows the feed
+	mustRun(t, s, "login", "alice")
+	assertContains(t, mustRun(t, s, "following"), "  - Go blog\n")
+}
+
+func apiPostTitles(t *testing.T, h http.Handler, path, key string) []string {
+	t.Helper()
+	var posts []postOutput
+	apiCall(t, h, "GET", path, key, "", http.StatusOK, &posts)
+	titles := []string{}
+	for _, post := range posts {
+		titles = append(titles, post.Title)
+	}
+	return titles
+}
+
+func TestAPIPosts(t *testing.T) {
+	s, srv, key, h := newAPITest(t)
+	mustRun(t, s, "addfeed", "News", srv.URL+"/news.xml")
+	fetchFeeds(t, s)
+	mustRun(t, s, "read", postByTitle(t, s, "Fuzzing").ID.String())
+	release := postByTitle(t, s, "Release notes")
+
+	assertTitles(t, apiPostTitles(t, h, "/api/posts", key), "Release notes", "Error handling", "Generics in Go")
+	assertTitles(t, apiPostTitles(t, h, "/api/posts?all=true&limit=2", key), "Release notes", "Fuzzing")
+	assertTitles(t, apiPostTitles(t, h, "/api/posts?unread=false&sort=asc&limit=2&page=2", key), "Fuzzing", "Release notes")
+	assertTitles(t, apiPostTitles(t, h, "/api/posts?feed=News", key), "Release notes")
+	assertTitles(t, apiPostTitles(t, h, "/api/posts?all=true&since=2023-01-03&until=2023-01-05", key), "Fuzzing", "Error handling")
+	assertTitles(t, apiPostTitles(t, h, "/api/posts?all=true&limit=200&offset=3", key), "Generics in Go")
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=-1",
+		"limit=201",
+		"limit=4294967297",
+		"limit=many",
+		"page=x",
+		"offset=-1",
+		"offset=99999999999",
+		"page=1&offset=1",
+		"sort=up",
+		"since=someday",
+		"after=not-an-id",
+	} {
+		assertAPIError(t, h, "GET", "/api/posts?"+query, key, "", http.StatusBadRequest)
+	}
+
+	// Posts of feeds the user does not follow cannot be used as a cursor
+	assertTitles(t, apiPostTitles(t, h, "/api/posts?all=true&after="+release.ID.String(), key), "Fuzzing", "Error handling", "Generics in Go")
+	mustRun(t, s, "unfollow", srv.URL+"/news.xml")
+	assertAPIError(t, h, "GET", "/api/posts?after="+release.ID.String(), key, "", http.StatusBadRequest)
+}
+
+func TestAPIStarredAndSearch(t *testing.T) {
+	s, _, key, h := newAPITest(t)
+	mustRun(t, s, "star", postByTitle(t, s, "Error handling").ID.String())
+
+	assertTitles(t, apiPostTitles(t, h, "/api/posts/starred", key), "Error handling")
+
+	var results []searchResultOutput
+	apiCall(t, h, "GET", "/api/posts/search?q=generics", key, "", http.StatusOK, &results)
+	if len(results) != 1 || results[0].Title != "Generics in Go" || results[0].FeedName != "Go blog" {
+		t.Errorf("Unexpected search results %+v", results)
+	}
+	apiCall(t, h, "GET", "/api/posts/search?q=generics&limit=1", key, "", http.StatusOK, &results)
+	assertAPIError(t, h, "GET", "/api/posts/search", key, "", http.StatusBadRequest)
+	assertAPIError(t, h, "GET", "/api/posts/search?q=go&limit=0", key, "", http.StatusBadRequest)
+	assertAPIError(t, h, "GET", "/api/posts/search?q=go&limit=1000", key, "", http.StatusBadRequest)
+}
+
+func TestAPIMarkAllRead(t *testing.T) {
+	s, srv, key, h := newAPITest(t)
+	mustRun(t, s, "addfeed", "News", srv.URL+"/news.xml")
+	fetchFeeds(t, s)
+	feed, err := s.db.GetFeedByUrl(context.Background(), srv.URL+"/rss.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resp struct {
+		Marked int64 `json:"marked"`
+	}
+	apiCall(t, h, "POST", "/api/posts/mark-all-read?feed_id="+feed.ID.String(), key, "", http.StatusOK, &resp)
+	if resp.Marked != 3 {
+		t.Errorf("Marked %d posts, want 3", resp.Marked)
+	}
+	assertTitles(t, apiPostTitles(t, h, "/api/posts", key), "Release notes")
+	apiCall(t, h, "POST", "/api/posts/mark-all-read", key, "", http.StatusOK, &resp)
+	if resp.Marked != 1 {
+		t.Errorf("Marked %d posts, want 1", resp.Marked)
+	}
+	assertTitles(t, apiPostTitles(t, h, "/api/posts", key))
+	assertAPIError(t, h, "POST", "/api/posts/mark-all-read?feed_id=x", key, "", http.StatusBadRequest)
+}
+
+func TestAPIPostState(t *testing.T) {
+	s, srv, key, h := newAPITest(t)
+	post := postByTitle(t, s, "Fuzzing")
+	path := "/api/posts/" + post.ID.String()
+
+	apiCall(t, h, "PUT", path+"/read", key, "", http.StatusNoContent, nil)
+	assertTitles(t, apiPostTitles(t, h, "/api/posts", key), "Error handling", "Generics in Go")
+	apiCall(t, h, "DELETE", path+"/read", key, "", http.StatusNoContent, nil)
+	assertTitles(t, apiPostTitles(t, h, "/api/posts", key), "Fuzzing", "Error handling", "Generics in Go")
+
+	apiCall(t, h, "PUT", path+"/star", key, "", http.StatusNoContent, nil)
+	assertTitles(t, apiPostTitles(t, h, "/api/posts/starred", key), "Fuzzing")
+	apiCall(t, h, "DELETE", path+"/star", key, "", http.StatusNoContent, nil)
+	assertTitles(t, apiPostTitles(t, h, "/api/posts/starred", key))
+
+	assertAPIError(t, h, "PUT", "/api/posts/not-an-id/read", key, "", http.StatusBadRequest)
+	assertAPIError(t, h, "PUT", "/api/posts/00000000-0000-0000-0000-000000000000/star", key, "", http.StatusNotFound)
+
+	// Posts of feeds the user does not follow cannot be changed
+	mustRun(t, s, "register", "bob")
+	bobKey := createAPIKey(t, s, "bob")
+	for _, method := range []string{"PUT", "DELETE"} {
+		assertAPIError(t, h, method, path+"/read", bobKey, "", http.StatusNotFound)
+		assertAPIError(t, h, method, path+"/star", bobKey, "", http.StatusNotFound)
+	}
+	bob, _ := s.db.GetUser(context.Background(), "bob")
+	starred, err := s.db.GetStarredPostsForUser(context.Background(), bob.ID)
+	if err != nil || len(starred) != 0 {
+		t.Errorf("bob starred a post of a feed not followed: %+v, %v", starred, err)
+	}
+
+	mustRun(t, s, "follow", srv.URL+"/rss.xml")
+	apiCall(t, h, "PUT", path+"/star", bobKey, "", http.StatusNoContent, nil)
+	assertTitles(t, apiPostTitles(t, h, "/api/posts/starred", bobKey), "Fuzzing")
+	assertTitles(t, apiPostTitles(t, h, "/api/posts/starred", key))
+}
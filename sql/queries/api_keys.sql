@@ -0,0 +1,43 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (id, created_at, user_id, name, key_hash, prefix, fever_key_hash)
+VALUES (
+  $1,
+  $2,
+  $3,
+  $4,
+  $5,
+  $6,
+  $7
+)
+RETURNING *;
+
+-- name: GetAPIKeysForUser :many
+SELECT * FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetUserByAPIKey :one
+-- Returns the owner of the key with the given hash unless the key has been
+-- revoked.
+SELECT users.* FROM users
+INNER JOIN api_keys
+ON api_keys.user_id = users.id
+WHERE api_keys.key_hash = $1 AND api_keys.revoked_at IS NULL;
+
+-- name: GetUserByFeverKey :one
+-- Returns the owner of the key whose Fever API key has the given hash unless
+-- the key has been revoked.
+SELECT users.* FROM users
+INNER JOIN api_keys
+ON api_keys.user_id = users.id
+WHERE api_keys.fever_key_hash = sqlc.arg(fever_key_hash)::text AND api_keys.revoked_at IS NULL;
+
+-- name: MarkAPIKeyUsed :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE key_hash = $1;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
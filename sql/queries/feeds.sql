@@ -10,7 +10,9 @@ INSERT INTO feeds (id, created_at, updated_at, name, url, user_id) VALUES(
 RETURNING *;
 
 -- name: GetFeedsWithCreators :many
-SELECT feeds.name, feeds.url, users.name AS user_name
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.last_fetched_at,
+  feeds.consecutive_failures, feeds.last_error, feeds.last_success_at,
+  feeds.last_http_status, feeds.disabled, users.name AS user_name
 FROM feeds
 INNER JOIN users
 ON users.id = feeds.user_id;
@@ -24,7 +26,65 @@ UPDATE feeds
 SET last_fetched_at = NOW(), updated_at = NOW()
 WHERE feeds.id = $1;
 
--- name: GetNextFeedToFetch :one
+-- name: ClaimNextFeedsToFetch :many
+-- Leases the least recently fetched feeds that are not claimed by another
+-- worker and were not fetched since fetched_before. Expired leases from
+-- crashed workers can be claimed again.
+UPDATE feeds
+SET claimed_until = NOW() + sqlc.arg(lease_seconds)::int * INTERVAL '1 second'
+WHERE feeds.id IN (
+  SELECT id FROM feeds
+  WHERE NOT disabled
+  AND (retry_after IS NULL OR retry_after <= NOW())
+  AND (claimed_until IS NULL OR claimed_until < NOW())
+  AND (last_fetched_at IS NULL OR last_fetched_at < sqlc.arg(fetched_before)::timestamptz)
+  ORDER BY last_fetched_at NULLS FIRST
+  LIMIT sqlc.arg(batch_size)
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET claimed_until = NULL
+WHERE feeds.id = $1;
+
+-- name: SetFeedCacheValidators :exec
+UPDATE feeds
+SET etag = $2, last_modified = $3, updated_at = NOW()
+WHERE feeds.id = $1;
+
+-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET consecutive_failures = 0, last_error = NULL, last_http_status = $2,
+  last_success_at = NOW(), retry_after = NULL, updated_at = NOW()
+WHERE feeds.id = $1;
+
+-- name: RecordFeedFailure :one
+-- Backs the feed off until retry_after and disables it once the number of
+-- consecutive failures reaches max_failures.
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1,
+  last_error = sqlc.arg(last_error),
+  last_http_status = sqlc.arg(last_http_status),
+  retry_after = NOW() + sqlc.arg(backoff_seconds)::int * INTERVAL '1 second',
+  disabled = consecutive_failures + 1 >= sqlc.arg(max_failures)::int,
+  updated_at = NOW()
+WHERE feeds.id = sqlc.arg(id)
+RETURNING *;
+
+-- name: EnableFeed :exec
+UPDATE feeds
+SET disabled = FALSE, consecutive_failures = 0, retry_after = NULL, updated_at = NOW()
+WHERE feeds.id = $1;
+
+-- name: GetFeedByFeverID :one
 SELECT * FROM feeds
-ORDER BY last_fetched_at NULLS FIRST
-LIMIT 1;
+WHERE fever_id = $1;
+
+-- name: GetFollowedFeeds :many
+SELECT feeds.* FROM feeds
+INNER JOIN feed_follows
+ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1
+ORDER BY feeds.fever_id;
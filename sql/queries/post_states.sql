@@ -0,0 +1,64 @@
+-- name: MarkPostRead :exec
+INSERT INTO post_states(user_id, post_id, created_at, updated_at, read, read_at)
+VALUES ($1, $2, NOW(), NOW(), TRUE, NOW())
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE, read_at = NOW(), updated_at = NOW();
+
+-- name: MarkPostUnread :exec
+INSERT INTO post_states(user_id, post_id, created_at, updated_at, read, read_at)
+VALUES ($1, $2, NOW(), NOW(), FALSE, NULL)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = FALSE, read_at = NULL, updated_at = NOW();
+
+-- name: MarkAllPostsRead :execrows
+-- Marks the unread posts of the feeds the user follows as read, or only
+-- those of one feed if feed_id is given, and only posts added before the
+-- before time if it is given.
+INSERT INTO post_states(user_id, post_id, created_at, updated_at, read, read_at)
+SELECT feed_follows.user_id, posts.id, NOW(), NOW(), TRUE, NOW()
+FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(feed_id)::uuid IS NULL OR posts.feed_id = sqlc.narg(feed_id)::uuid)
+AND (sqlc.narg(before)::timestamp IS NULL OR posts.created_at < sqlc.narg(before)::timestamp)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE, read_at = NOW(), updated_at = NOW()
+WHERE NOT post_states.read;
+
+-- name: StarPost :exec
+INSERT INTO post_states(user_id, post_id, created_at, updated_at, starred, starred_at)
+VALUES ($1, $2, NOW(), NOW(), TRUE, NOW())
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET starred = TRUE, starred_at = NOW(), updated_at = NOW();
+
+-- name: UnstarPost :exec
+UPDATE post_states
+SET starred = FALSE, starred_at = NULL, updated_at = NOW()
+WHERE user_id = $1 AND post_id = $2;
+
+-- name: GetStarredPostsForUser :many
+SELECT posts.*, post_states.read, post_states.starred_at
+FROM posts
+INNER JOIN post_states
+ON post_states.post_id = posts.id
+WHERE post_states.user_id = $1 AND post_states.starred
+ORDER BY post_states.starred_at DESC;
+
+-- name: GetUnreadFeverIDs :many
+SELECT posts.fever_id FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states
+ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1 AND post_states.read IS NOT TRUE
+ORDER BY posts.fever_id;
+
+-- name: GetStarredFeverIDs :many
+SELECT posts.fever_id FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+INNER JOIN post_states
+ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = $1 AND post_states.starred
+ORDER BY posts.fever_id;
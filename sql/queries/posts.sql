@@ -1,14 +1,134 @@
 -- name: CreatePost :one
-INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id)
+-- Returns no rows if the feed already has a post with the same guid.
+INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash)
 VALUES(
-  $1, $2, $3, $4, $5, $6, $7, $8
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
 )
+ON CONFLICT (feed_id, guid) DO NOTHING
 RETURNING *;
 
--- name: GetPostsForUser :many
+-- name: GetPost :one
+SELECT * FROM posts
+WHERE id = $1;
+
+-- name: AdoptPostGuid :one
+-- Sets the guid of the feed's post that was saved with its URL as guid, as
+-- posts stored before guids were. Returns no rows if there is no such post.
+UPDATE posts
+SET guid = $3
+WHERE feed_id = $1 AND url = $2 AND guid = url
+RETURNING *;
+
+-- name: GetPostByGuid :one
+SELECT * FROM posts
+WHERE feed_id = $1 AND guid = $2;
+
+-- name: GetPostForUser :one
+-- Returns the post if it belongs to a feed the user follows.
 SELECT posts.* FROM posts
 INNER JOIN feed_follows
 ON feed_follows.feed_id = posts.feed_id
-WHERE feed_follows.user_id = $1
-ORDER BY posts.published_at DESC
-LIMIT $2;
+WHERE posts.id = $1 AND feed_follows.user_id = $2;
+
+-- name: UpdatePostContent :one
+UPDATE posts
+SET title = $2, url = $3, description = $4, content_hash = $5, updated_at = NOW()
+WHERE posts.id = $1
+RETURNING *;
+
+-- name: CreatePostRevision :exec
+INSERT INTO post_revisions(id, created_at, post_id, title, url, description)
+VALUES(
+  $1, $2, $3, $4, $5, $6
+);
+
+-- name: GetPostsForUser :many
+-- Lists the posts of the feeds the user follows. All filters are optional.
+-- Paging works either with an offset or by continuing after a given post,
+-- identified by its published_at and id.
+SELECT posts.*, (
+  SELECT COUNT(*) FROM post_revisions
+  WHERE post_revisions.post_id = posts.id
+) AS revisions, COALESCE(post_states.read, FALSE) AS read,
+COALESCE(post_states.starred, FALSE) AS starred
+FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+LEFT JOIN post_states
+ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (NOT sqlc.arg(unread_only)::bool OR post_states.read IS NOT TRUE)
+AND (sqlc.narg(feed)::text IS NULL OR feeds.url = sqlc.narg(feed)::text OR feeds.name = sqlc.narg(feed)::text)
+AND (sqlc.narg(since)::timestamp IS NULL OR posts.published_at >= sqlc.narg(since)::timestamp)
+AND (sqlc.narg(until)::timestamp IS NULL OR posts.published_at < sqlc.narg(until)::timestamp)
+AND (
+  sqlc.narg(after_published_at)::timestamp IS NULL
+  OR (sqlc.arg(sort_asc)::bool AND (posts.published_at, posts.id) > (sqlc.narg(after_published_at)::timestamp, sqlc.narg(after_id)::uuid))
+  OR (NOT sqlc.arg(sort_asc)::bool AND (posts.published_at, posts.id) < (sqlc.narg(after_published_at)::timestamp, sqlc.narg(after_id)::uuid))
+)
+ORDER BY
+  CASE WHEN sqlc.arg(sort_asc)::bool THEN posts.published_at END ASC,
+  CASE WHEN sqlc.arg(sort_asc)::bool THEN posts.id END ASC,
+  CASE WHEN NOT sqlc.arg(sort_asc)::bool THEN posts.published_at END DESC,
+  CASE WHEN NOT sqlc.arg(sort_asc)::bool THEN posts.id END DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: SearchPostsForUser :many
+-- Full-text search over the posts of the feeds the user follows, best
+-- matches first. Matches in the snippet are wrapped in asterisks. The
+-- searched document is the expression indexed by posts_search_idx.
+SELECT posts.id, posts.title, posts.url, posts.published_at, feeds.name AS feed_name,
+  ts_rank(
+    setweight(to_tsvector('english', COALESCE(posts.title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(posts.description, '')), 'B'),
+    search_query) AS rank,
+  ts_headline('english', posts.title || ' ' || COALESCE(posts.description, ''), search_query,
+    'StartSel=*, StopSel=*, MaxFragments=2, MaxWords=20, MinWords=5') AS snippet
+FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+CROSS JOIN websearch_to_tsquery('english', sqlc.arg(query)) AS search_query
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (
+  setweight(to_tsvector('english', COALESCE(posts.title, '')), 'A') ||
+  setweight(to_tsvector('english', COALESCE(posts.description, '')), 'B')
+) @@ search_query
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetPostByFeverID :one
+SELECT * FROM posts
+WHERE fever_id = $1;
+
+-- name: CountPostsForUser :one
+SELECT COUNT(*) FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = $1;
+
+-- name: GetFeverItemsForUser :many
+-- Lists the posts of the feeds the user follows by fever_id: those after
+-- since_id in ascending order, those before max_id in descending order, or
+-- those in with_ids.
+SELECT posts.*, feeds.fever_id AS feed_fever_id,
+COALESCE(post_states.read, FALSE) AS read,
+COALESCE(post_states.starred, FALSE) AS starred
+FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+LEFT JOIN post_states
+ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(since_id)::bigint IS NULL OR posts.fever_id > sqlc.narg(since_id)::bigint)
+AND (sqlc.narg(max_id)::bigint IS NULL OR posts.fever_id < sqlc.narg(max_id)::bigint)
+AND (sqlc.narg(with_ids)::bigint[] IS NULL OR posts.fever_id = ANY(sqlc.narg(with_ids)::bigint[]))
+ORDER BY
+  CASE WHEN sqlc.narg(max_id)::bigint IS NULL THEN posts.fever_id END ASC,
+  posts.fever_id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD claimed_until TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN claimed_until;
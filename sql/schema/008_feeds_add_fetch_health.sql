@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD last_error TEXT,
+ADD consecutive_failures INTEGER NOT NULL DEFAULT 0,
+ADD last_success_at TIMESTAMP,
+ADD last_http_status INTEGER,
+ADD retry_after TIMESTAMP,
+ADD disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN last_error,
+DROP COLUMN consecutive_failures,
+DROP COLUMN last_success_at,
+DROP COLUMN last_http_status,
+DROP COLUMN retry_after,
+DROP COLUMN disabled;
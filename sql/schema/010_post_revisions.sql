@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE posts
+ADD content_hash TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE post_revisions(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  title TEXT NOT NULL,
+  url TEXT NOT NULL,
+  description TEXT
+);
+
+-- +goose Down
+DROP TABLE post_revisions;
+
+ALTER TABLE posts
+DROP COLUMN content_hash;
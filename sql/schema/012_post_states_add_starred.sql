@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE post_states
+ADD starred BOOLEAN NOT NULL DEFAULT FALSE,
+ADD starred_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE post_states
+DROP COLUMN starred,
+DROP COLUMN starred_at;
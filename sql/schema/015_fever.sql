@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD fever_id BIGSERIAL UNIQUE;
+
+ALTER TABLE posts
+ADD fever_id BIGSERIAL UNIQUE;
+
+ALTER TABLE api_keys
+ADD fever_key_hash TEXT UNIQUE;
+
+-- +goose Down
+ALTER TABLE api_keys
+DROP COLUMN fever_key_hash;
+
+ALTER TABLE posts
+DROP COLUMN fever_id;
+
+ALTER TABLE feeds
+DROP COLUMN fever_id;
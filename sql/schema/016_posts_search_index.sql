@@ -0,0 +1,23 @@
+-- +goose Up
+-- Index the search document as an expression, so the tsvector is not a
+-- column of posts that every query returning posts has to load.
+DROP INDEX posts_search_vector_idx;
+
+ALTER TABLE posts
+DROP COLUMN search_vector;
+
+CREATE INDEX posts_search_idx ON posts USING GIN ((
+  setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+  setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+));
+
+-- +goose Down
+DROP INDEX posts_search_idx;
+
+ALTER TABLE posts
+ADD search_vector TSVECTOR GENERATED ALWAYS AS (
+  setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+  setweight(to_tsvector('english', COALESCE(description, '')), 'B')
+) STORED;
+
+CREATE INDEX posts_search_vector_idx ON posts USING GIN (search_vector);
@@ -0,0 +1,20 @@
+-- name: CreateFeedFollow :one
+-- SQLite has no data-modifying CTEs, so the names are looked up in the
+-- RETURNING clause instead.
+INSERT INTO feed_follows(id, created_at, updated_at, user_id, feed_id)
+VALUES (?, ?, ?, ?, ?)
+RETURNING *,
+  (SELECT users.name FROM users WHERE users.id = feed_follows.user_id) AS user_name,
+  (SELECT feeds.name FROM feeds WHERE feeds.id = feed_follows.feed_id) AS feed_name;
+
+-- name: GetFeedFollowsForUser :many
+SELECT feed_follows.*, users.name AS user_name, feeds.name AS feed_name, feeds.url AS feed_url
+FROM feed_follows
+INNER JOIN users ON users.id = feed_follows.user_id
+INNER JOIN feeds ON feeds.id = feed_follows.feed_id
+WHERE feed_follows.user_id = ?
+ORDER BY feeds.name;
+
+-- name: DeleteFeedFollow :exec
+DELETE FROM feed_follows
+WHERE feed_follows.user_id = ? AND feed_follows.feed_id = ?;
@@ -0,0 +1,91 @@
+-- name: CreateFeed :one
+INSERT INTO feeds (id, created_at, updated_at, name, url, user_id, fever_id) VALUES(
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  ?,
+  (SELECT COALESCE(MAX(fever_id), 0) + 1 FROM feeds)
+)
+RETURNING *;
+
+-- name: GetFeedsWithCreators :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.last_fetched_at,
+  feeds.consecutive_failures, feeds.last_error, feeds.last_success_at,
+  feeds.last_http_status, feeds.disabled, users.name AS user_name
+FROM feeds
+INNER JOIN users
+ON users.id = feeds.user_id;
+
+-- name: GetFeedByUrl :one
+SELECT * FROM feeds
+WHERE url = ?;
+
+-- name: MarkFeedFetched :exec
+UPDATE feeds
+SET last_fetched_at = sqlc.arg(now), updated_at = sqlc.arg(now)
+WHERE feeds.id = sqlc.arg(id);
+
+-- name: ClaimNextFeedsToFetch :many
+-- Leases the least recently fetched feeds that are not claimed by another
+-- worker and were not fetched since fetched_before. Expired leases from
+-- crashed workers can be claimed again. SQLite allows a single writer, so
+-- the claim needs no row locks.
+UPDATE feeds
+SET claimed_until = sqlc.arg(claimed_until)
+WHERE feeds.id IN (
+  SELECT id FROM feeds
+  WHERE NOT disabled
+  AND (retry_after IS NULL OR retry_after <= sqlc.arg(now))
+  AND (claimed_until IS NULL OR claimed_until < sqlc.arg(now))
+  AND (last_fetched_at IS NULL OR last_fetched_at < sqlc.arg(fetched_before))
+  ORDER BY last_fetched_at NULLS FIRST
+  LIMIT sqlc.arg(batch_size)
+)
+RETURNING *;
+
+-- name: ReleaseFeedClaim :exec
+UPDATE feeds
+SET claimed_until = NULL
+WHERE feeds.id = ?;
+
+-- name: SetFeedCacheValidators :exec
+UPDATE feeds
+SET etag = sqlc.arg(etag), last_modified = sqlc.arg(last_modified), updated_at = sqlc.arg(now)
+WHERE feeds.id = sqlc.arg(id);
+
+-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET consecutive_failures = 0, last_error = NULL, last_http_status = sqlc.arg(last_http_status),
+  last_success_at = sqlc.arg(now), retry_after = NULL, updated_at = sqlc.arg(now)
+WHERE feeds.id = sqlc.arg(id);
+
+-- name: RecordFeedFailure :one
+-- Backs the feed off until retry_after and disables it once the number of
+-- consecutive failures reaches max_failures.
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1,
+  last_error = sqlc.arg(last_error),
+  last_http_status = sqlc.arg(last_http_status),
+  retry_after = sqlc.arg(retry_after),
+  disabled = consecutive_failures + 1 >= sqlc.arg(max_failures),
+  updated_at = sqlc.arg(now)
+WHERE feeds.id = sqlc.arg(id)
+RETURNING *;
+
+-- name: EnableFeed :exec
+UPDATE feeds
+SET disabled = FALSE, consecutive_failures = 0, retry_after = NULL, updated_at = sqlc.arg(now)
+WHERE feeds.id = sqlc.arg(id);
+
+-- name: GetFeedByFeverID :one
+SELECT * FROM feeds
+WHERE fever_id = ?;
+
+-- name: GetFollowedFeeds :many
+SELECT feeds.* FROM feeds
+INNER JOIN feed_follows
+ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = ?
+ORDER BY feeds.fever_id;
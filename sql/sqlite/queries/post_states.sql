@@ -0,0 +1,64 @@
+-- name: MarkPostRead :exec
+INSERT INTO post_states(user_id, post_id, created_at, updated_at, read, read_at)
+VALUES (sqlc.arg(user_id), sqlc.arg(post_id), sqlc.arg(now), sqlc.arg(now), TRUE, sqlc.arg(now))
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE, read_at = sqlc.arg(now), updated_at = sqlc.arg(now);
+
+-- name: MarkPostUnread :exec
+INSERT INTO post_states(user_id, post_id, created_at, updated_at, read, read_at)
+VALUES (sqlc.arg(user_id), sqlc.arg(post_id), sqlc.arg(now), sqlc.arg(now), FALSE, NULL)
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = FALSE, read_at = NULL, updated_at = sqlc.arg(now);
+
+-- name: MarkAllPostsRead :execrows
+-- Marks the unread posts of the feeds the user follows as read, or only
+-- those of one feed if feed_id is given, and only posts added before the
+-- before time if it is given.
+INSERT INTO post_states(user_id, post_id, created_at, updated_at, read, read_at)
+SELECT feed_follows.user_id, posts.id, sqlc.arg(now), sqlc.arg(now), TRUE, sqlc.arg(now)
+FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(feed_id) IS NULL OR posts.feed_id = sqlc.narg(feed_id))
+AND (sqlc.narg(before) IS NULL OR posts.created_at < sqlc.narg(before))
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET read = TRUE, read_at = sqlc.arg(now), updated_at = sqlc.arg(now)
+WHERE NOT post_states.read;
+
+-- name: StarPost :exec
+INSERT INTO post_states(user_id, post_id, created_at, updated_at, starred, starred_at)
+VALUES (sqlc.arg(user_id), sqlc.arg(post_id), sqlc.arg(now), sqlc.arg(now), TRUE, sqlc.arg(now))
+ON CONFLICT (user_id, post_id) DO UPDATE
+SET starred = TRUE, starred_at = sqlc.arg(now), updated_at = sqlc.arg(now);
+
+-- name: UnstarPost :exec
+UPDATE post_states
+SET starred = FALSE, starred_at = NULL, updated_at = sqlc.arg(now)
+WHERE user_id = sqlc.arg(user_id) AND post_id = sqlc.arg(post_id);
+
+-- name: GetStarredPostsForUser :many
+SELECT posts.*, post_states.read, post_states.starred_at
+FROM posts
+INNER JOIN post_states
+ON post_states.post_id = posts.id
+WHERE post_states.user_id = ? AND post_states.starred
+ORDER BY post_states.starred_at DESC;
+
+-- name: GetUnreadFeverIDs :many
+SELECT posts.fever_id FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+LEFT JOIN post_states
+ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = ? AND post_states.read IS NOT TRUE
+ORDER BY posts.fever_id;
+
+-- name: GetStarredFeverIDs :many
+SELECT posts.fever_id FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+INNER JOIN post_states
+ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = ? AND post_states.starred
+ORDER BY posts.fever_id;
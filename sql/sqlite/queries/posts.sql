@@ -0,0 +1,129 @@
+-- name: CreatePost :one
+-- Returns no rows if the feed already has a post with the same guid.
+INSERT INTO posts(id, created_at, updated_at, title, url, description, published_at, feed_id, guid, content_hash, fever_id)
+VALUES(
+  ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(fever_id), 0) + 1 FROM posts)
+)
+ON CONFLICT (feed_id, guid) DO NOTHING
+RETURNING *;
+
+-- name: GetPost :one
+SELECT * FROM posts
+WHERE id = ?;
+
+-- name: AdoptPostGuid :one
+-- Sets the guid of the feed's post that was saved with its URL as guid, as
+-- posts stored before guids were. Returns no rows if there is no such post.
+UPDATE posts
+SET guid = sqlc.arg(guid)
+WHERE feed_id = sqlc.arg(feed_id) AND url = sqlc.arg(url) AND guid = url
+RETURNING *;
+
+-- name: GetPostByGuid :one
+SELECT * FROM posts
+WHERE feed_id = ? AND guid = ?;
+
+-- name: GetPostForUser :one
+-- Returns the post if it belongs to a feed the user follows.
+SELECT posts.* FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+WHERE posts.id = ? AND feed_follows.user_id = ?;
+
+-- name: UpdatePostContent :one
+UPDATE posts
+SET title = sqlc.arg(title), url = sqlc.arg(url), description = sqlc.arg(description),
+  content_hash = sqlc.arg(content_hash), updated_at = sqlc.arg(now)
+WHERE posts.id = sqlc.arg(id)
+RETURNING *;
+
+-- name: CreatePostRevision :exec
+INSERT INTO post_revisions(id, created_at, post_id, title, url, description)
+VALUES(
+  ?, ?, ?, ?, ?, ?
+);
+
+-- name: GetPostsForUser :many
+-- Lists the posts of the feeds the user follows. All filters are optional.
+-- Paging works either with an offset or by continuing after a given post,
+-- identified by its published_at and id.
+SELECT posts.*, (
+  SELECT COUNT(*) FROM post_revisions
+  WHERE post_revisions.post_id = posts.id
+) AS revisions, CAST(COALESCE(post_states.read, FALSE) AS BOOLEAN) AS read,
+CAST(COALESCE(post_states.starred, FALSE) AS BOOLEAN) AS starred
+FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+LEFT JOIN post_states
+ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (NOT CAST(sqlc.arg(unread_only) AS BOOLEAN) OR post_states.read IS NOT TRUE)
+AND (sqlc.narg(feed) IS NULL OR feeds.url = sqlc.narg(feed) OR feeds.name = sqlc.narg(feed))
+AND (sqlc.narg(since) IS NULL OR posts.published_at >= sqlc.narg(since))
+AND (sqlc.narg(until) IS NULL OR posts.published_at < sqlc.narg(until))
+AND (
+  sqlc.narg(after_published_at) IS NULL
+  OR (CAST(sqlc.arg(sort_asc) AS BOOLEAN) AND (posts.published_at, posts.id) > (sqlc.narg(after_published_at), sqlc.narg(after_id)))
+  OR (NOT CAST(sqlc.arg(sort_asc) AS BOOLEAN) AND (posts.published_at, posts.id) < (sqlc.narg(after_published_at), sqlc.narg(after_id)))
+)
+ORDER BY
+  CASE WHEN CAST(sqlc.arg(sort_asc) AS BOOLEAN) THEN posts.published_at END ASC,
+  CASE WHEN CAST(sqlc.arg(sort_asc) AS BOOLEAN) THEN posts.id END ASC,
+  CASE WHEN NOT CAST(sqlc.arg(sort_asc) AS BOOLEAN) THEN posts.published_at END DESC,
+  CASE WHEN NOT CAST(sqlc.arg(sort_asc) AS BOOLEAN) THEN posts.id END DESC
+LIMIT sqlc.arg('limit') OFFSET sqlc.arg('offset');
+
+-- name: SearchPostsForUser :many
+-- Full-text search over the posts of the feeds the user follows, best
+-- matches first. The query uses FTS5 syntax. Matches in the snippet are
+-- wrapped in asterisks.
+SELECT posts.id, posts.title, posts.url, posts.published_at, feeds.name AS feed_name,
+  CAST(-bm25(posts_fts, 10.0, 1.0) AS REAL) AS rank,
+  CAST(snippet(posts_fts, -1, '*', '*', '...', 20) AS TEXT) AS snippet
+FROM posts_fts
+INNER JOIN posts
+ON posts.rowid = posts_fts.rowid
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+WHERE posts_fts MATCH sqlc.arg(query)
+AND feed_follows.user_id = sqlc.arg(user_id)
+ORDER BY rank DESC, posts.published_at DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetPostByFeverID :one
+SELECT * FROM posts
+WHERE fever_id = ?;
+
+-- name: CountPostsForUser :one
+SELECT COUNT(*) FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+WHERE feed_follows.user_id = ?;
+
+-- name: GetFeverItemsForUser :many
+-- Lists the posts of the feeds the user follows by fever_id: those after
+-- since_id in ascending order, those before max_id in descending order, or
+-- those in with_ids, given as a JSON array.
+SELECT posts.*, feeds.fever_id AS feed_fever_id,
+CAST(COALESCE(post_states.read, FALSE) AS BOOLEAN) AS read,
+CAST(COALESCE(post_states.starred, FALSE) AS BOOLEAN) AS starred
+FROM posts
+INNER JOIN feed_follows
+ON feed_follows.feed_id = posts.feed_id
+INNER JOIN feeds
+ON feeds.id = posts.feed_id
+LEFT JOIN post_states
+ON post_states.post_id = posts.id AND post_states.user_id = feed_follows.user_id
+WHERE feed_follows.user_id = sqlc.arg(user_id)
+AND (sqlc.narg(since_id) IS NULL OR posts.fever_id > sqlc.narg(since_id))
+AND (sqlc.narg(max_id) IS NULL OR posts.fever_id < sqlc.narg(max_id))
+AND (sqlc.narg(with_ids) IS NULL OR posts.fever_id IN (SELECT value FROM json_each(CAST(sqlc.narg(with_ids) AS TEXT))))
+ORDER BY
+  CASE WHEN sqlc.narg(max_id) IS NULL THEN posts.fever_id END ASC,
+  posts.fever_id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,110 @@
+-- +goose Up
+-- The SQLite schema matches the PostgreSQL schema in sql/schema up to
+-- 013_posts_add_search_vector.sql. UUIDs are stored as text and timestamps
+-- as UTC text, and full-text search uses an FTS5 index instead of tsvector.
+CREATE TABLE users(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE feeds(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  name TEXT NOT NULL,
+  url TEXT NOT NULL UNIQUE,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  last_fetched_at TIMESTAMP,
+  etag TEXT,
+  last_modified TEXT,
+  claimed_until TIMESTAMP,
+  last_error TEXT,
+  consecutive_failures INTEGER NOT NULL DEFAULT 0,
+  last_success_at TIMESTAMP,
+  last_http_status INTEGER,
+  retry_after TIMESTAMP,
+  disabled BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE feed_follows(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE
+);
+
+CREATE TABLE posts(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  title TEXT NOT NULL,
+  url TEXT NOT NULL,
+  description TEXT,
+  published_at TIMESTAMP NOT NULL,
+  feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+  guid TEXT NOT NULL,
+  content_hash TEXT NOT NULL DEFAULT '',
+  UNIQUE (feed_id, guid)
+);
+
+CREATE TABLE post_revisions(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  title TEXT NOT NULL,
+  url TEXT NOT NULL,
+  description TEXT
+);
+
+CREATE TABLE post_states(
+  user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  read BOOLEAN NOT NULL DEFAULT FALSE,
+  read_at TIMESTAMP,
+  starred BOOLEAN NOT NULL DEFAULT FALSE,
+  starred_at TIMESTAMP,
+  PRIMARY KEY (user_id, post_id)
+);
+
+-- Titles and descriptions of posts, kept in sync by the triggers below
+CREATE VIRTUAL TABLE posts_fts USING fts5(
+  title, description, content='posts', content_rowid='rowid',
+  tokenize='porter unicode61'
+);
+
+-- +goose StatementBegin
+CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+  INSERT INTO posts_fts(rowid, title, description)
+  VALUES (new.rowid, new.title, new.description);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+  INSERT INTO posts_fts(posts_fts, rowid, title, description)
+  VALUES ('delete', old.rowid, old.title, old.description);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER posts_fts_update AFTER UPDATE OF title, description ON posts BEGIN
+  INSERT INTO posts_fts(posts_fts, rowid, title, description)
+  VALUES ('delete', old.rowid, old.title, old.description);
+  INSERT INTO posts_fts(rowid, title, description)
+  VALUES (new.rowid, new.title, new.description);
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE posts_fts;
+DROP TABLE post_states;
+DROP TABLE post_revisions;
+DROP TABLE posts;
+DROP TABLE feed_follows;
+DROP TABLE feeds;
+DROP TABLE users;
@@ -0,0 +1,37 @@
+-- +goose Up
+-- SQLite cannot add columns with unique or non-constant defaults, so new
+-- rows get their fever_id from the CreateFeed and CreatePost queries.
+ALTER TABLE feeds
+ADD fever_id INTEGER NOT NULL DEFAULT 0;
+
+UPDATE feeds SET fever_id = rowid;
+
+CREATE UNIQUE INDEX feeds_fever_id_idx ON feeds(fever_id);
+
+ALTER TABLE posts
+ADD fever_id INTEGER NOT NULL DEFAULT 0;
+
+UPDATE posts SET fever_id = rowid;
+
+CREATE UNIQUE INDEX posts_fever_id_idx ON posts(fever_id);
+
+ALTER TABLE api_keys
+ADD fever_key_hash TEXT;
+
+CREATE UNIQUE INDEX api_keys_fever_key_hash_idx ON api_keys(fever_key_hash);
+
+-- +goose Down
+DROP INDEX api_keys_fever_key_hash_idx;
+
+ALTER TABLE api_keys
+DROP COLUMN fever_key_hash;
+
+DROP INDEX posts_fever_id_idx;
+
+ALTER TABLE posts
+DROP COLUMN fever_id;
+
+DROP INDEX feeds_fever_id_idx;
+
+ALTER TABLE feeds
+DROP COLUMN fever_id;